@@ -1,16 +1,22 @@
 package octopus
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
-type HandlerFunc func(*Ctx)
+type HandlerFunc func(*Ctx) error
 
 type App struct {
 	sync.RWMutex
@@ -20,7 +26,25 @@ type App struct {
 	globalMiddleware []HandlerFunc
 	subApps          []*route
 	errorHandlers    map[statusCode]HandlerFunc
+	names            map[string]string // route name -> pattern
+	mountedIn        *App              // set by Mount, for URL
+	mountPrefix      string
 	Store            *value
+
+	// ErrorHandler receives the errors returned by handler chains. It
+	// defaults to DefaultErrorHandler.
+	ErrorHandler ErrorHandlerFunc
+
+	// ShutdownTimeout bounds how long Run waits for in-flight requests and
+	// open streams to finish after SIGINT or SIGTERM.
+	ShutdownTimeout time.Duration
+
+	pool sync.Pool // of *Ctx
+
+	server     *http.Server
+	done       chan struct{}
+	closeOnce  sync.Once
+	onShutdown []func()
 }
 
 func New() *App {
@@ -28,42 +52,81 @@ func New() *App {
 		subApps:          make([]*route, 0),
 		routes:           new(routes),
 		errorHandlers:    make(map[statusCode]HandlerFunc),
+		names:            make(map[string]string),
 		w:                sync.WaitGroup{},
 		globalMiddleware: make([]HandlerFunc, 0),
 		Store:            new(value),
+		ErrorHandler:     DefaultErrorHandler,
+		ShutdownTimeout:  10 * time.Second,
+		done:             make(chan struct{}),
 	}
 }
 
-func (a *App) handle(pattern string, handlers []HandlerFunc, methods ...string) {
+func (a *App) handle(pattern string, handlers []HandlerFunc, methods ...string) *registration {
 	a.Lock()
 	defer a.Unlock()
+	chain := make([]HandlerFunc, 0, len(a.globalMiddleware)+len(handlers))
+	chain = append(chain, a.globalMiddleware...)
+	chain = append(chain, handlers...)
 	for _, method := range methods {
-		handlers = append(a.globalMiddleware, handlers...)
-		a.routes.add(pattern, method, handlers...)
+		a.routes.add(pattern, method, chain...)
 	}
+	return &registration{a: a, pattern: pattern}
 }
 
-// func (a *app) Mount(path string, subApp *app) {
-// 	a.Lock()
-// 	defer a.Unlock()
+// Mount serves sub under prefix. Matching requests are handed to sub with
+// the prefix stripped from their path, so sub keeps its own routes,
+// middleware, error handlers and Store. Middleware registered on a with Use
+// before the call runs ahead of sub's own.
+func (a *App) Mount(prefix string, sub *App) {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	a.Lock()
+	a.subApps = append(a.subApps, &route{path: prefix, a: sub})
+	a.Unlock()
+
+	sub.Lock()
+	sub.mountedIn, sub.mountPrefix = a, prefix
+	sub.Unlock()
+
+	handler := func(c *Ctx) error {
+		if r, w := c.Request(), c.response; r != nil && w != nil {
+			sub.ServeHTTP(w, stripPrefix(prefix, r))
+		}
+		return nil
+	}
+	if prefix != "" {
+		a.Any(prefix, handler)
+	}
+	a.Any(prefix+"/*", handler)
+}
 
-// 	route := &route{
-// 		path: path,
-// 		a:    subApp,
-// 	}
-// 	a.subApps = append(a.subApps, route)
-// }
+// stripPrefix returns a shallow copy of r whose path has prefix removed.
+func stripPrefix(prefix string, r *http.Request) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+	if r2.URL.Path == "" {
+		r2.URL.Path = "/"
+	}
+	if r.URL.RawPath != "" {
+		r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+		if r2.URL.RawPath == "" {
+			r2.URL.RawPath = "/"
+		}
+	}
+	return r2
+}
 
 func (a *App) Static(path string, dir string) {
 	fileServer := http.FileServer(http.Dir(dir))
-	a.Get(path+"*", func(c *Ctx) {
-		r, rok := c.Values.Get("request")
-		w, wok := c.Values.Get("response")
-		if rok && wok {
-			r := r.(*http.Request)
-			w := w.(http.ResponseWriter)
+	a.Get(path+"*", func(c *Ctx) error {
+		if r, w := c.request, c.response; r != nil && w != nil {
 			http.StripPrefix(path, fileServer).ServeHTTP(w, r)
 		}
+		return nil
 	})
 }
 
@@ -81,41 +144,41 @@ func (a *App) Group(path string, fn ...HandlerFunc) *route {
 	return r
 }
 
-func (a *App) DELETE(path string, handler ...HandlerFunc) {
-	a.handle(path, handler, "DELETE")
+func (a *App) DELETE(path string, handler ...HandlerFunc) *registration {
+	return a.handle(path, handler, "DELETE")
 }
 
-func (a *App) Get(path string, handler ...HandlerFunc) {
-	a.handle(path, handler, "GET")
+func (a *App) Get(path string, handler ...HandlerFunc) *registration {
+	return a.handle(path, handler, "GET")
 }
 
-func (a *App) PUT(path string, handler ...HandlerFunc) {
-	a.handle(path, handler, "PUT")
+func (a *App) PUT(path string, handler ...HandlerFunc) *registration {
+	return a.handle(path, handler, "PUT")
 }
 
-func (a *App) Post(path string, handler ...HandlerFunc) {
-	a.handle(path, handler, "POST")
+func (a *App) Post(path string, handler ...HandlerFunc) *registration {
+	return a.handle(path, handler, "POST")
 }
 
-func (a *App) PATCH(path string, handler ...HandlerFunc) {
-	a.handle(path, handler, "PATCH")
+func (a *App) PATCH(path string, handler ...HandlerFunc) *registration {
+	return a.handle(path, handler, "PATCH")
 }
 
-func (a *App) OPTIONS(path string, handler ...HandlerFunc) {
-	a.handle(path, handler, "OPTIONS")
+func (a *App) OPTIONS(path string, handler ...HandlerFunc) *registration {
+	return a.handle(path, handler, "OPTIONS")
 }
 
-func (a *App) HEAD(path string, handler ...HandlerFunc) {
-	a.handle(path, handler, "HEAD")
+func (a *App) HEAD(path string, handler ...HandlerFunc) *registration {
+	return a.handle(path, handler, "HEAD")
 }
 
-func (a *App) Any(path string, handler ...HandlerFunc) {
-	a.handle(path, handler, "GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS", "HEAD")
+func (a *App) Any(path string, handler ...HandlerFunc) *registration {
+	return a.handle(path, handler, "GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS", "HEAD")
 }
 
-func (a *App) Method(method string, path string, handler ...HandlerFunc) {
+func (a *App) Method(method string, path string, handler ...HandlerFunc) *registration {
 	methods := strings.Split(method, " ")
-	a.handle(path, handler, methods...)
+	return a.handle(path, handler, methods...)
 }
 
 func (a *App) OnErrorCode(code statusCode, f HandlerFunc) {
@@ -124,12 +187,21 @@ func (a *App) OnErrorCode(code statusCode, f HandlerFunc) {
 	a.errorHandlers[code] = f
 }
 
+func (a *App) hasErrorHandler(code statusCode) bool {
+	a.RLock()
+	defer a.RUnlock()
+	_, exists := a.errorHandlers[code]
+	return exists
+}
+
 func (a *App) handleError(code statusCode, c *Ctx) {
 	a.RLock()
 	handler, exists := a.errorHandlers[code]
 	a.RUnlock()
 	if exists {
-		handler(c)
+		if err := handler(c); err != nil {
+			log.Printf("octopus: error handler for %d: %v", code, err)
+		}
 	} else {
 		func(c *Ctx) {
 			message := statusMessages[code]
@@ -141,79 +213,193 @@ func (a *App) handleError(code statusCode, c *Ctx) {
 }
 
 func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	c := &Ctx{handlers: nil, index: 0, Values: new(value), Context: r.Context()}
-	c.Values.Set("request", r)
-	c.Values.Set("response", w)
-	c.Values.Set("app", a)
-
-	var routExist = false
-
-	a.routes.rrange(func(path string, route *route) bool {
-		hs, ok := route.methodExists(r.Method)
-		if strings.HasSuffix(path, "*") {
-			if strings.HasPrefix(r.URL.Path, strings.TrimSuffix(path, "*")) {
-				if ok {
-					c.handlers = hs
-					c.Next()
-					routExist = true
-					return false
-				} else {
-					c.Status(StatusMethodNotAllowed)
-					routExist = true
-					return false
-				}
-			}
-		} else {
-			if path == r.URL.Path {
-				if ok {
-					c.handlers = hs
-					c.Next()
-					routExist = true
-					return false
-				} else {
-					c.Status(StatusMethodNotAllowed)
-					routExist = true
-					return false
-				}
+	a.w.Add(1)
+	defer a.w.Done()
+
+	// An App served from another one's chain (Mount, adaptor) starts with
+	// the locals set so far for the request.
+	c := a.acquireCtx(w, r)
+	defer a.releaseCtx(c)
+	if parent, ok := FromContext(r.Context()); ok {
+		c.Values.inherit(parent.Values)
+	}
+
+	rt, params := a.routes.match(r.URL.Path, c.params)
+	c.params = params
+	if rt == nil {
+		c.Status(StatusNotFound)
+		return
+	}
+	hs, ok := rt.methodExists(r.Method)
+	if !ok {
+		switch r.Method {
+		case http.MethodHead:
+			if hs, ok = rt.methodExists(http.MethodGet); ok {
+				c.response = headResponse{w}
 			}
+		case http.MethodOptions:
+			hs, ok = a.optionsChain(rt.allowed()), true
 		}
-		return true
+	}
+	if !ok {
+		w.Header().Set("Allow", rt.allowed())
+		c.Status(StatusMethodNotAllowed)
+		return
+	}
+	c.handlers = hs
+	if err := c.Next(); err != nil {
+		a.ErrorHandler(c, err)
+	}
+}
+
+// optionsChain answers OPTIONS requests on paths without an OPTIONS route
+// with the methods they accept. The global middleware runs first, so that
+// CORS preflights reach the CORS middleware.
+func (a *App) optionsChain(allow string) []HandlerFunc {
+	a.RLock()
+	defer a.RUnlock()
+	chain := make([]HandlerFunc, 0, len(a.globalMiddleware)+1)
+	chain = append(chain, a.globalMiddleware...)
+	return append(chain, func(c *Ctx) error {
+		c.response.Header().Set("Allow", allow)
+		c.response.WriteHeader(int(StatusNoContent))
+		return nil
 	})
+}
 
-	if !routExist {
-		c.Status(StatusNotFound)
+// headResponse serves HEAD requests with GET handlers by dropping the body
+// they write.
+type headResponse struct {
+	http.ResponseWriter
+}
+
+func (w headResponse) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// Unwrap lets http.ResponseController reach the Flusher and Hijacker of the
+// underlying writer, so that streaming handlers also answer HEAD.
+func (w headResponse) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// acquireCtx returns a recycled Ctx ready to serve r.
+func (a *App) acquireCtx(w http.ResponseWriter, r *http.Request) *Ctx {
+	c, _ := a.pool.Get().(*Ctx)
+	if c == nil {
+		c = new(Ctx)
 	}
+	c.reset(a, w, r)
+	return c
 }
 
-func checkServer(addr string) {
-	resp, err := http.Get("http://" + addr)
+// releaseCtx clears c, so that it holds on to nothing of the request, and
+// returns it to the pool.
+func (a *App) releaseCtx(c *Ctx) {
+	c.reset(nil, nil, nil)
+	a.pool.Put(c)
+}
+
+// Run listens on addr and serves the App until it receives SIGINT or
+// SIGTERM, or until Shutdown is called. On a signal it drains in-flight
+// requests for at most ShutdownTimeout before returning.
+func (a *App) Run(addr string) error {
+	ln, err := net.Listen("tcp", addr)
 	if err != nil {
-		log.Println("Server is not running")
-	} else {
-		defer resp.Body.Close()
-		displayLaunchMessage(addr)
+		return err
 	}
+	return a.Serve(ln)
 }
 
-func (a *App) Run(addr string) error {
-	// a.mountSubApp()
+// Serve is like Run but accepts connections on an existing listener.
+func (a *App) Serve(ln net.Listener) error {
+	srv := &http.Server{Handler: a}
+	a.Lock()
+	a.server = srv
+	a.Unlock()
 
-	a.w.Add(1)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
 	go func() {
-		defer a.w.Done()
-		if err := http.ListenAndServe(addr, a); err != nil {
-			log.Fatal(err)
+		errCh <- srv.Serve(ln)
+	}()
+	displayLaunchMessage(ln.Addr().String())
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
 		}
+		return err
+	case <-ctx.Done():
+		stop()
+		sctx, cancel := context.WithTimeout(context.Background(), a.ShutdownTimeout)
+		defer cancel()
+		return a.Shutdown(sctx)
+	}
+}
+
+// Shutdown stops accepting connections, signals long-lived handlers such as
+// SSE streams through Done, and waits for in-flight requests to return or
+// for ctx to expire, whichever comes first.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.beginShutdown()
+
+	a.RLock()
+	srv := a.server
+	a.RUnlock()
+
+	var err error
+	if srv != nil {
+		err = srv.Shutdown(ctx)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		a.w.Wait()
+		close(drained)
 	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+	return err
+}
 
-	// Attendre que le serveur démarre
-	time.Sleep(time.Second)
+// Done returns a channel that is closed when the App starts shutting down.
+// Handlers that stream responses should return once it is closed.
+func (a *App) Done() <-chan struct{} {
+	return a.done
+}
+
+// OnShutdown registers f to run when the App starts shutting down.
+func (a *App) OnShutdown(f func()) {
+	a.Lock()
+	defer a.Unlock()
+	a.onShutdown = append(a.onShutdown, f)
+}
 
-	// Vérifier si le serveur est en cours d'exécution
-	checkServer(addr)
+func (a *App) beginShutdown() {
+	a.closeOnce.Do(func() {
+		close(a.done)
 
-	a.w.Wait()
-	return nil
+		a.RLock()
+		hooks := a.onShutdown
+		subApps := a.subApps
+		a.RUnlock()
+
+		for _, f := range hooks {
+			f()
+		}
+		for _, sub := range subApps {
+			sub.a.beginShutdown()
+		}
+	})
 }
 
 func displayLaunchMessage(addr string) {
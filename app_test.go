@@ -1,10 +1,14 @@
 package octopus
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -44,3 +48,159 @@ func pingURL(url string) (int, string, error) {
 
 	return resp.StatusCode, string(body), nil
 }
+
+func TestMount(t *testing.T) {
+	billing := New()
+	billing.Store.Set("name", "billing")
+	billing.Use(func(c *Ctx) error {
+		c.WriteString("billing-mw ")
+		return c.Next()
+	})
+	billing.Get("/", func(c *Ctx) error { return c.WriteString("index") })
+	billing.Get("/invoices/:id", func(c *Ctx) error {
+		store, _ := c.AppStore()
+		name, _ := store.Get("name")
+		return c.WriteString(name.(string) + " invoice " + c.Param("id"))
+	})
+	billing.OnErrorCode(StatusNotFound, func(c *Ctx) error { return c.WriteString("no such invoice") })
+
+	app := New()
+	app.Use(func(c *Ctx) error {
+		c.Response().Header().Set("X-Parent", "1")
+		return c.Next()
+	})
+	app.Get("/billing/health", func(c *Ctx) error { return c.WriteString("parent health") })
+	app.Mount("/billing/", billing)
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/billing", http.StatusOK, "billing-mw index"},
+		{"/billing/", http.StatusOK, "billing-mw index"},
+		{"/billing/invoices/12", http.StatusOK, "billing-mw billing invoice 12"},
+		{"/billing/unknown", http.StatusNotFound, "no such invoice"},
+		{"/billing/health", http.StatusOK, "parent health"},
+		{"/billingx", http.StatusNotFound, "Not Found"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+		if rr.Code != tt.status || rr.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q, want %d %q", tt.path, rr.Code, rr.Body.String(), tt.status, tt.body)
+		}
+		if tt.status == http.StatusOK && rr.Header().Get("X-Parent") != "1" {
+			t.Errorf("%s: parent middleware did not run", tt.path)
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	app := New()
+	started := make(chan struct{})
+	streaming := make(chan struct{})
+	app.Get("/slow", func(c *Ctx) error {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		return c.WriteString("done")
+	})
+	app.Get("/stream", func(c *Ctx) error {
+		close(streaming)
+		<-app.Done()
+		return c.WriteString("closed")
+	})
+	var hooked bool
+	app.OnShutdown(func() { hooked = true })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- app.Serve(ln) }()
+
+	base := "http://" + ln.Addr().String()
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	stream := make(chan result, 1)
+	go func() {
+		_, body, err := pingURL(base + "/stream")
+		stream <- result{body, err}
+	}()
+	go func() {
+		_, body, err := pingURL(base + "/slow")
+		slow <- result{body, err}
+	}()
+	<-started
+	<-streaming
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := app.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+	if r := <-slow; r.err != nil || r.body != "done" {
+		t.Errorf("in-flight request: got %q, %v", r.body, r.err)
+	}
+	if r := <-stream; r.err != nil || r.body != "closed" {
+		t.Errorf("stream: got %q, %v", r.body, r.err)
+	}
+	if !hooked {
+		t.Error("OnShutdown hook did not run")
+	}
+}
+
+func TestRunError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if err := New().Run(ln.Addr().String()); err == nil {
+		t.Error("expected Run to fail on an address already in use")
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	app := New()
+	app.OnErrorCode(StatusNotFound, func(c *Ctx) error { return c.WriteString("custom not found") })
+	app.Use(func(c *Ctx) error {
+		return c.Next()
+	})
+	app.Get("/missing", func(c *Ctx) error { return NewError(StatusNotFound, "user missing") })
+	app.Get("/conflict", func(c *Ctx) error { return NewError(StatusConflict, "already exists") })
+	app.Get("/teapot", func(c *Ctx) error { return NewError(StatusTeapot) })
+	app.Get("/boom", func(c *Ctx) error { return errors.New("database down") })
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/missing", http.StatusNotFound, "custom not found"},
+		{"/conflict", http.StatusConflict, "already exists"},
+		{"/teapot", http.StatusTeapot, "I'm a teapot"},
+		{"/boom", http.StatusInternalServerError, "Internal Server Error"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+		if rr.Code != tt.status || rr.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q, want %d %q", tt.path, rr.Code, rr.Body.String(), tt.status, tt.body)
+		}
+	}
+
+	var got error
+	app.ErrorHandler = func(c *Ctx, err error) { got = err }
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/boom", nil))
+	if got == nil || got.Error() != "database down" {
+		t.Errorf("custom ErrorHandler got %v", got)
+	}
+}
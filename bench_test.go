@@ -0,0 +1,69 @@
+package octopus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// The benchmarks below cover the request hot path. Run them with
+//
+//	go test -run XXX -bench ServeHTTP -benchmem
+//
+// and compare allocations before merging changes to App or Ctx.
+
+func BenchmarkServeHTTPStatic(b *testing.B) {
+	app := New()
+	app.Get("/health", func(c *Ctx) error {
+		return nil
+	})
+	benchmarkServe(b, app, "/health")
+}
+
+func BenchmarkServeHTTPParam(b *testing.B) {
+	app := New()
+	app.Get("/users/:id/posts/:post", func(c *Ctx) error {
+		if c.Param("id") == "" || c.Param("post") == "" {
+			b.Fatal("missing params")
+		}
+		return nil
+	})
+	benchmarkServe(b, app, "/users/42/posts/7")
+}
+
+func BenchmarkServeHTTPQuery(b *testing.B) {
+	app := New()
+	app.Get("/search", func(c *Ctx) error {
+		if c.Query("q") == "" || c.Query("page") == "" {
+			b.Fatal("missing query")
+		}
+		return nil
+	})
+	benchmarkServe(b, app, "/search?q=octopus&page=2")
+}
+
+func BenchmarkServeHTTPJSON(b *testing.B) {
+	app := New()
+	app.Get("/users/:id", func(c *Ctx) error {
+		return c.JSON(Map{"id": c.Param("id"), "name": "ana"})
+	})
+	benchmarkServe(b, app, "/users/42")
+}
+
+func benchmarkServe(b *testing.B, app *App, target string) {
+	req := httptest.NewRequest("GET", target, nil)
+	w := discard{header: http.Header{}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		app.ServeHTTP(w, req)
+	}
+}
+
+// discard is a ResponseWriter that keeps nothing, so that benchmarks only
+// measure the App.
+type discard struct{ header http.Header }
+
+func (d discard) Header() http.Header         { return d.header }
+func (d discard) Write(p []byte) (int, error) { return len(p), nil }
+func (d discard) WriteHeader(int)             {}
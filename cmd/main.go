@@ -1,6 +1,7 @@
 package main
 
 import (
+	"log"
 	"net/http"
 	"time"
 
@@ -8,6 +9,7 @@ import (
 	"github.com/abdotop/octopus/middleware/adaptor"
 	"github.com/abdotop/octopus/middleware/cors"
 	"github.com/abdotop/octopus/sse"
+	"github.com/abdotop/octopus/websocket"
 	// "github.com/abdotop/octopus/middleware/cor"
 )
 
@@ -32,96 +34,106 @@ func main() {
 
 	app.Get("/middleware", adaptor.HTTPHandler(next))
 
-	app.Get("/sse", func(c *octopus.Ctx) {
-		conn, err := sse.ConnFrom(c, new(sse.ClientConfig).Default())
-		if err != nil {
-			c.Status(octopus.StatusInternalServerError).JSON(octopus.Map{"error": err.Error()})
-			return
-		}
+	hub := sse.New()
 
-		store, err := c.AppStore()
+	app.Get("/sse", func(c *octopus.Ctx) error {
+		conn, err := hub.ConnFrom(c, new(sse.ClientConfig).Default())
 		if err != nil {
-			c.Status(octopus.StatusInternalServerError).JSON(octopus.Map{"error": err.Error()})
-			return
+			return err
+		}
+		if topic := c.Query("topic"); topic != "" {
+			hub.Subscribe(conn.ID(), topic)
 		}
-
-		store.Set("sse:"+conn.ID(), conn)
 
 		notify := conn.Done()
 		for {
 			select {
 			case <-notify:
 				println("Close the connection when the client disconnects")
-				store.Delete(conn.ID())
-				return // Close the connection when the client disconnects
+				return nil // Close the connection when the client disconnects
 			default:
 				// Send an event
-				conn.SendJSON(octopus.Map{
+				if err := conn.SendJSON(octopus.Map{
 					"id":   conn.ID(),
 					"time": time.Now(),
-				})
+				}); err != nil {
+					return nil
+				}
 			}
 
 			time.Sleep(5 * time.Second) // Simulate some delay
 		}
 	})
 
-	app.Post("/getsse", func(c *octopus.Ctx) {
+	app.Post("/getsse", func(c *octopus.Ctx) error {
 		type res struct {
 			ID string
 		}
 		r := new(res)
-		if c.BodyParser(r) != nil {
-			c.Status(octopus.StatusBadRequest)
+		if err := c.BodyParser(r); err != nil {
+			return octopus.NewError(octopus.StatusBadRequest, err.Error())
 		}
 
-		store, err := c.AppStore()
-		if err != nil {
-			c.Status(octopus.StatusInternalServerError).JSON(octopus.Map{"error": err.Error()})
-			return
+		conn, ok := hub.Get(r.ID)
+		if !ok {
+			return octopus.NewError(octopus.StatusNotFound, "no connection found with ID "+r.ID)
 		}
+		return conn.Event("myEventType").SendText("Get test ok")
+	})
 
-		value, ok := store.Get("sse:" + r.ID)
-
-		if !ok {
-			c.Status(octopus.StatusInternalServerError).JSON(octopus.Map{"error": "no connection found with ID " + r.ID})
-			return
+	app.Post("/publish", func(c *octopus.Ctx) error {
+		type res struct {
+			Topic string
+			Data  string
 		}
-		conn, ok := value.(*sse.Conn)
-		if !ok {
-			c.Status(octopus.StatusInternalServerError).JSON(octopus.Map{"error": "failed to convert the value to *sse.Conn"})
-			return
+		r := new(res)
+		if err := c.BodyParser(r); err != nil {
+			return octopus.NewError(octopus.StatusBadRequest, err.Error())
+		}
+		if r.Topic == "" {
+			hub.Broadcast(sse.NewEvent("message", r.Data))
+		} else {
+			hub.Publish(r.Topic, sse.NewEvent("message", r.Data))
 		}
-		conn.Event("myEventType").SendText("Get test ok")
+		return nil
 	})
 
-	app.Post("/deletesse", func(c *octopus.Ctx) {
+	app.Post("/deletesse", func(c *octopus.Ctx) error {
 		type res struct {
 			ID string
 		}
 		r := new(res)
-		if c.BodyParser(r) != nil {
-			c.Status(octopus.StatusBadRequest)
+		if err := c.BodyParser(r); err != nil {
+			return octopus.NewError(octopus.StatusBadRequest, err.Error())
 		}
-		store, err := c.AppStore()
-		if err != nil {
-			c.Status(octopus.StatusInternalServerError).JSON(octopus.Map{"error": err.Error()})
-			return
+
+		conn, ok := hub.Get(r.ID)
+		if !ok {
+			return octopus.NewError(octopus.StatusNotFound, "no connection found with ID "+r.ID)
 		}
+		return conn.Close()
+	})
 
-		value, ok := store.Get("sse:" + r.ID)
+	rooms := websocket.New()
 
-		if !ok {
-			c.Status(octopus.StatusInternalServerError).JSON(octopus.Map{"error": "no connection found with ID " + r.ID})
-			return
+	// Chat: every message is relayed to the other members of ?room=
+	app.Get("/ws", func(c *octopus.Ctx) error {
+		conn, err := rooms.Upgrade(c, &websocket.Config{EnableCompression: true, PingInterval: 30 * time.Second})
+		if err != nil {
+			return err
 		}
-		conn, ok := value.(*sse.Conn)
-		if !ok {
-			c.Status(octopus.StatusInternalServerError).JSON(octopus.Map{"error": "failed to convert the value to *sse.Conn"})
-			return
+		room := c.Query("room")
+		rooms.Join(conn.ID(), room)
+		for {
+			t, data, err := conn.ReadMessage()
+			if err != nil {
+				return nil
+			}
+			rooms.Publish(room, t, data, conn.ID())
 		}
-		conn.Close()
 	})
 
-	app.Run(":8089")
+	if err := app.Run(":8089"); err != nil {
+		log.Fatal(err)
+	}
 }
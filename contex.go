@@ -1,6 +1,7 @@
 package octopus
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -8,6 +9,8 @@ import (
 	"html/template"
 	"net"
 	"net/http"
+	"net/url"
+	"path/filepath"
 	"strings"
 )
 
@@ -17,38 +20,132 @@ type Ctx struct {
 	index    int
 	Values   *value
 	Context  context.Context
-	// sse      *sse
+	params   []param
+
+	request  *http.Request
+	response http.ResponseWriter
+	app      *App
+	values   value // backs Values unless it is shared with another Ctx
+	bound    bool  // request carries the Ctx in its context
+
+	// Parsed lazily and kept for the rest of the request
+	query   url.Values
+	form    url.Values
+	cookies []*http.Cookie
 }
 
 func NewCtx() *Ctx {
-	return &Ctx{
-		handlers: []HandlerFunc{},
-		index:    0,
-		Values:   new(value),
-		Context:  context.Background(),
+	c := new(Ctx)
+	c.reset(nil, nil, nil)
+	c.handlers = []HandlerFunc{}
+	c.Context = context.Background()
+	return c
+}
+
+// NewCtx returns a Ctx serving r with a, as App.ServeHTTP does before
+// running a route's handlers.
+func (a *App) NewCtx(w http.ResponseWriter, r *http.Request) *Ctx {
+	c := new(Ctx)
+	c.reset(a, w, r)
+	return c
+}
+
+// reset prepares ctx for serving r. Ctx objects are recycled once
+// App.ServeHTTP returns, so handlers must not keep them, or anything
+// obtained from Values, past that point.
+func (ctx *Ctx) reset(a *App, w http.ResponseWriter, r *http.Request) {
+	ctx.handlers = nil
+	ctx.index = 0
+	ctx.params = ctx.params[:0]
+	ctx.request, ctx.response, ctx.app = r, w, a
+	ctx.bound = false
+	ctx.Context = nil
+	if r != nil {
+		ctx.Context = r.Context()
+	}
+	ctx.values.reset()
+	ctx.Values = &ctx.values
+	ctx.query, ctx.form, ctx.cookies = nil, nil, nil
+}
+
+// Copy returns a Ctx at the same point of the chain as ctx, for code that
+// may keep running after ctx is recycled, such as handlers called from
+// another goroutine. The copy is never pooled. Values set through either
+// Ctx are seen by both, and its Request carries the copy.
+func (ctx *Ctx) Copy() *Ctx {
+	c := new(Ctx)
+	c.handlers, c.index = ctx.handlers, ctx.index
+	c.params = append([]param(nil), ctx.params...)
+	c.request, c.response, c.app = ctx.request, ctx.response, ctx.app
+	c.Context = ctx.Context
+	// The values move to the copy, which outlives ctx
+	c.values.inherit(ctx.Values)
+	c.Values = &c.values
+	ctx.Values = c.Values
+	return c
+}
+
+// Request returns the request being served. Its context carries the Ctx, see
+// FromContext.
+func (ctx *Ctx) Request() *http.Request {
+	// The copy is only made for the handlers that ask for the request
+	if !ctx.bound && ctx.request != nil && ctx.app != nil {
+		ctx.request = ctx.request.WithContext(context.WithValue(ctx.request.Context(), ctxKey{}, ctx))
+		ctx.bound = true
 	}
+	return ctx.request
+}
+
+// SetRequest replaces the request seen by the rest of the chain, for
+// middleware that derives one with a new context or headers.
+func (ctx *Ctx) SetRequest(r *http.Request) {
+	ctx.request = r
+	ctx.bound = true
+	ctx.query, ctx.form, ctx.cookies = nil, nil, nil
+}
+
+// Response returns the ResponseWriter of the request.
+func (ctx *Ctx) Response() http.ResponseWriter {
+	return ctx.response
+}
+
+// SetResponse replaces the ResponseWriter used by the rest of the chain, for
+// middleware that wraps it.
+func (ctx *Ctx) SetResponse(w http.ResponseWriter) {
+	ctx.response = w
+}
+
+// App returns the App serving the request, or nil for a Ctx built with the
+// package-level NewCtx.
+func (ctx *Ctx) App() *App {
+	return ctx.app
 }
 
 type Map = map[string]interface{}
 
+// ctxKey is the http.Request context key under which App.ServeHTTP stores
+// the request's Ctx.
+type ctxKey struct{}
+
+// FromContext returns the Ctx of the octopus request ctx belongs to, when ctx
+// derives from the context of Ctx.Request. It lets net/http code called
+// from a handler chain reach the App, its Store and the request values.
+func FromContext(ctx context.Context) (*Ctx, bool) {
+	c, ok := ctx.Value(ctxKey{}).(*Ctx)
+	return c, ok
+}
+
 func (ctx *Ctx) AppStore() (*value, error) {
-	app_value, ok := ctx.Values.Get("app")
-	if !ok {
-		return nil, fmt.Errorf("failed to get App from context")
-	}
-	app, ok := app_value.(*App)
-	if !ok {
+	if ctx.app == nil {
 		return nil, fmt.Errorf("failed to get App from context")
 	}
-	return app.Store, nil
+	return ctx.app.Store, nil
 }
 
 func (ctx *Ctx) BodyParser(out interface{}) error {
 	// c.RLock()
 	// defer c.RUnlock()
-	r, ok := ctx.Values.Get("request")
-	if ok {
-		r := r.(*http.Request)
+	if r := ctx.request; r != nil {
 		return json.NewDecoder(r.Body).Decode(&out)
 	}
 	return errors.New("request not found in context values")
@@ -58,68 +155,107 @@ func (ctx *Ctx) BodyParser(out interface{}) error {
 func (ctx *Ctx) Get(key string) string {
 	// c.RLock()
 	// defer c.RUnlock()
-	r, ok := ctx.Values.Get("request")
-	if ok {
-		r := r.(*http.Request)
+	if r := ctx.request; r != nil {
 		return r.Header.Get(key)
 	}
 	return ""
 }
 
-// func (c *Ctx) GetSse() (*sse, error) {
-// 	app_value, ok := c.Values.Get("app")
-// 	if !ok {
-// 		return nil, fmt.Errorf("failed to get App from context")
-// 	}
-// 	app, ok := app_value.(*App)
-// 	if !ok {
-// 		return nil, fmt.Errorf("failed to get App from context")
-// 	}
-// 	return app.sse_service, nil
-// }
-
 func (ctx *Ctx) JSON(data interface{}) error {
 	// c.Lock()
 	// defer c.Unlock()
-	r, ok := ctx.Values.Get("response")
-	if ok {
-		r := r.(http.ResponseWriter)
+	if r := ctx.response; r != nil {
 		r.Header().Set("Content-Type", "application/json")
 		return json.NewEncoder(r).Encode(data)
 	}
 	return errors.New("response not found in context values")
 }
 
-func (ctx *Ctx) Next() {
+// Next runs the next handler in the chain and returns its error.
+func (ctx *Ctx) Next() error {
 	if ctx.index < len(ctx.handlers) {
 		handler := ctx.handlers[ctx.index]
 		ctx.index++
-		handler(ctx)
+		return handler(ctx)
 	}
+	return nil
+}
+
+// Param returns the value captured for the named route parameter, or an
+// empty string if the route has no such parameter. Catch-alls registered
+// without a name are available as "*".
+func (ctx *Ctx) Param(name string) string {
+	for _, p := range ctx.params {
+		if p.key == name {
+			return p.value
+		}
+	}
+	return ""
+}
+
+// Params returns all the route parameters captured for the request.
+func (ctx *Ctx) Params() map[string]string {
+	params := make(map[string]string, len(ctx.params))
+	for _, p := range ctx.params {
+		params[p.key] = p.value
+	}
+	return params
 }
 
 func (ctx *Ctx) Query(key string) string {
 	// c.RLock()
 	// defer c.RUnlock()
-	r, ok := ctx.Values.Get("request")
-	if ok {
-		r := r.(*http.Request)
-		return r.URL.Query().Get(key)
+	if ctx.query == nil && ctx.request != nil {
+		ctx.query = ctx.request.URL.Query()
 	}
-	return ""
+	return ctx.query.Get(key)
+}
+
+// FormValue returns the first value for key in the request body, URL-encoded
+// or multipart, falling back to the query string.
+func (ctx *Ctx) FormValue(key string) string {
+	if ctx.form == nil && ctx.request != nil {
+		r := ctx.request
+		// Parses URL-encoded bodies too; errors leave the form empty
+		r.ParseMultipartForm(32 << 20)
+		ctx.form = r.Form
+		if ctx.form == nil {
+			ctx.form = url.Values{}
+		}
+	}
+	return ctx.form.Get(key)
+}
+
+// Cookie returns the named cookie of the request.
+func (ctx *Ctx) Cookie(name string) (*http.Cookie, error) {
+	if ctx.cookies == nil && ctx.request != nil {
+		ctx.cookies = ctx.request.Cookies()
+	}
+	for _, c := range ctx.cookies {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, http.ErrNoCookie
 }
 
 func (ctx *Ctx) Render(path string, data interface{}) error {
 	// c.Lock()
 	// defer c.Unlock()
-	r, ok := ctx.Values.Get("response")
-	if ok {
-		r := r.(http.ResponseWriter)
-		tp, err := template.ParseFiles(path)
+	if r := ctx.response; r != nil {
+		tp, err := template.New(filepath.Base(path)).
+			Funcs(template.FuncMap{"url": ctx.owner().URL}).
+			ParseFiles(path)
 		if err != nil {
 			return err
 		}
-		return tp.Execute(r, data)
+		// Nothing is sent if the template fails halfway
+		var buf bytes.Buffer
+		if err := tp.Execute(&buf, data); err != nil {
+			return err
+		}
+		_, err = buf.WriteTo(r)
+		return err
 	}
 	return errors.New("response not found in context values")
 }
@@ -127,10 +263,8 @@ func (ctx *Ctx) Render(path string, data interface{}) error {
 func (ctx *Ctx) SendString(code statusCode, s string) error {
 	// c.Lock()
 	// defer c.Unlock()
-	r, ok := ctx.Values.Get("response")
-	if ok {
+	if r := ctx.response; r != nil {
 		ctx.Status(code)
-		r := r.(http.ResponseWriter)
 		_, err := r.Write([]byte(s))
 		return err
 	}
@@ -140,29 +274,28 @@ func (ctx *Ctx) SendString(code statusCode, s string) error {
 func (ctx *Ctx) Status(code statusCode) *Ctx {
 	// c.RLock()
 	// defer c.RUnlock()
-	r, ok := ctx.Values.Get("response")
-	a, appExist := ctx.Values.Get("app")
-	if ok {
-		r := r.(http.ResponseWriter)
+	if r := ctx.response; r != nil {
 		r.WriteHeader(int(code))
-		if appExist {
-			a := a.(*App)
-			a.handleError(code, ctx)
-		} else {
-			a := New()
-			a.handleError(code, ctx)
-		}
+		ctx.owner().handleError(code, ctx)
 	}
 	return ctx
 }
 
+// owner returns the App serving the request, or a blank one for contexts
+// built outside of App.ServeHTTP.
+func (ctx *Ctx) owner() *App {
+	if ctx.app != nil {
+		return ctx.app
+	}
+	return New()
+}
+
 func (ctx *Ctx) RemoteIP() (string, error) {
-	r, ok := ctx.Values.Get("request")
-	if !ok {
+	req := ctx.request
+	if req == nil {
 		return "", errors.New("request not found in context")
 	}
 
-	req := r.(*http.Request)
 	ips := extractValidIPsFromHeader(req, "X-Forwarded-For")
 	if len(ips) > 0 {
 		return ips[0], nil // retourne la première IP valide
@@ -198,30 +331,10 @@ func isValidIP(ip string) bool {
 	return net.ParseIP(ip) != nil
 }
 
-// func (c *Ctx) GetSseConnection(id string) (*sseConn, error) {
-// 	app_value, ok := c.Values.Get("app")
-
-// 	if !ok {
-// 		return nil, fmt.Errorf("failed to retrieve app from context")
-// 	}
-// 	app, ok := app_value.(*App)
-// 	if !ok {
-// 		return nil, fmt.Errorf("failed to retrieve app from context")
-// 	}
-// 	conn, ok := app.getConnection(id)
-// 	if !ok {
-// 		return nil, fmt.Errorf("no connection found with ID %s", id)
-// 	}
-
-// 	return conn, nil
-// }
-
 func (ctx *Ctx) WriteString(s string) error {
 	// c.RLock()
 	// defer c.RUnlock()
-	r, ok := ctx.Values.Get("response")
-	if ok {
-		r := r.(http.ResponseWriter)
+	if r := ctx.response; r != nil {
 		_, err := r.Write([]byte(s))
 		return err
 	}
@@ -0,0 +1,60 @@
+package octopus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCtxReuse(t *testing.T) {
+	app := New()
+	app.Get("/set/:id", func(c *Ctx) error {
+		SetLocal(c, userKey, "ana")
+		return c.WriteString(c.Param("id") + c.Query("q"))
+	})
+	app.Get("/check", func(c *Ctx) error {
+		if v, ok := Locals(c, userKey); ok {
+			t.Errorf("local %q survived the previous request", v)
+		}
+		if c.Param("id") != "" || c.Query("q") != "" || len(c.Params()) != 0 {
+			t.Error("params or query survived the previous request")
+		}
+		return c.WriteString("clean")
+	})
+
+	for i := 0; i < 10; i++ {
+		for target, want := range map[string]string{"/set/7?q=x": "7x", "/check": "clean"} {
+			rr := httptest.NewRecorder()
+			app.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+			if rr.Body.String() != want {
+				t.Fatalf("%s: got %q, want %q", target, rr.Body, want)
+			}
+		}
+	}
+}
+
+func TestRequestValues(t *testing.T) {
+	app := New()
+	app.Post("/", func(c *Ctx) error {
+		session, err := c.Cookie("session")
+		if err != nil {
+			return err
+		}
+		if _, err := c.Cookie("missing"); err != http.ErrNoCookie {
+			t.Errorf("Cookie(missing) error = %v", err)
+		}
+		return c.WriteString(strings.Join([]string{c.FormValue("name"), c.FormValue("page"), c.Query("page"), session.Value}, ","))
+	})
+
+	form := url.Values{"name": {"ana"}}
+	req := httptest.NewRequest("POST", "/?page=2", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, req)
+	if got := rr.Body.String(); got != "ana,2,2,abc" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,55 @@
+package octopus
+
+import (
+	"errors"
+	"log"
+)
+
+// ErrorHandlerFunc handles an error returned by a route's handler chain.
+type ErrorHandlerFunc func(*Ctx, error)
+
+// HTTPError is an error answered with a specific status code. Returning one
+// from a handler triggers the handler registered with OnErrorCode for that
+// code, or writes Message when there is none.
+type HTTPError struct {
+	Code    statusCode
+	Message string
+}
+
+// NewError returns an HTTPError for code. The message defaults to the
+// standard status text.
+func NewError(code statusCode, message ...string) *HTTPError {
+	e := &HTTPError{Code: code, Message: string(statusMessages[code])}
+	if len(message) > 0 {
+		e.Message = message[0]
+	}
+	return e
+}
+
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
+// DefaultErrorHandler answers *HTTPError values with their code and any
+// other error with StatusInternalServerError, deferring to the handler
+// registered with OnErrorCode when there is one.
+func DefaultErrorHandler(c *Ctx, err error) {
+	code, message := StatusInternalServerError, string(statusMessages[StatusInternalServerError])
+	var e *HTTPError
+	if errors.As(err, &e) {
+		code, message = e.Code, e.Message
+	} else {
+		log.Printf("octopus: %v", err)
+	}
+
+	if c.owner().hasErrorHandler(code) {
+		c.Status(code)
+		return
+	}
+
+	if w := c.response; w != nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(int(code))
+		w.Write([]byte(message))
+	}
+}
@@ -0,0 +1,33 @@
+package octopus
+
+// Key identifies a typed local. Keys are compared by identity, so locals of
+// different packages never collide even when their names do.
+type Key[T any] struct {
+	name string
+}
+
+// NewKey returns a new key for locals of type T. The name only serves for
+// debugging.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+func (k *Key[T]) String() string {
+	return k.name
+}
+
+// Locals returns the value stored under key for the request, and whether
+// there is one.
+func Locals[T any](c *Ctx, key *Key[T]) (T, bool) {
+	v, ok := c.Values.Get(key)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return v.(T), true
+}
+
+// SetLocal stores val under key for the rest of the request.
+func SetLocal[T any](c *Ctx, key *Key[T], val T) {
+	c.Values.Set(key, val)
+}
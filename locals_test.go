@@ -0,0 +1,60 @@
+package octopus
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+var (
+	userKey  = NewKey[string]("user")
+	otherKey = NewKey[string]("user")
+	countKey = NewKey[int]("count")
+)
+
+func TestLocals(t *testing.T) {
+	app := New()
+	app.Use(func(c *Ctx) error {
+		SetLocal(c, userKey, "ana")
+		SetLocal(c, countKey, 2)
+		return c.Next()
+	})
+	app.Get("/", func(c *Ctx) error {
+		user, ok := Locals(c, userKey)
+		if !ok || user != "ana" {
+			t.Errorf("Locals(userKey) = %q, %v", user, ok)
+		}
+		if n, _ := Locals(c, countKey); n != 2 {
+			t.Errorf("Locals(countKey) = %d", n)
+		}
+		// Keys with the same name are still distinct
+		if v, ok := Locals(c, otherKey); ok {
+			t.Errorf("Locals(otherKey) = %q", v)
+		}
+		if c.App() != app || c.Request() == nil || c.Response() == nil {
+			t.Error("Ctx is missing its App, Request or Response")
+		}
+		if got, _ := FromContext(c.Request().Context()); got != c {
+			t.Error("FromContext does not return the Ctx")
+		}
+		return c.WriteString("ok")
+	})
+
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Body.String() != "ok" {
+		t.Errorf("body %q", rr.Body)
+	}
+}
+
+func BenchmarkServeHTTPLocals(b *testing.B) {
+	app := New()
+	app.Use(func(c *Ctx) error {
+		SetLocal(c, userKey, "ana")
+		return c.Next()
+	})
+	app.Get("/users/:id", func(c *Ctx) error {
+		user, _ := Locals(c, userKey)
+		return c.WriteString(user)
+	})
+	benchmarkServe(b, app, "/users/42")
+}
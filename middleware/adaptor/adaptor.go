@@ -7,66 +7,93 @@ import (
 )
 
 func HTTPHandler(h http.Handler) octopus.HandlerFunc {
-	return func(c *octopus.Ctx) {
-		r, rok := c.Values.Get("request")
-		w, wok := c.Values.Get("response")
-		if rok && wok {
-			r := r.(*http.Request)
-			w := w.(http.ResponseWriter)
+	return func(c *octopus.Ctx) error {
+		if r, w := c.Request(), c.Response(); r != nil && w != nil {
 			h.ServeHTTP(w, r)
-			c.Next()
+			return c.Next()
 		}
+		return nil
 	}
 }
 
 func HTTPHandlerFunc(h http.HandlerFunc) octopus.HandlerFunc {
-	return func(c *octopus.Ctx) {
-		r, rok := c.Values.Get("request")
-		w, wok := c.Values.Get("response")
-		if rok && wok {
-			r := r.(*http.Request)
-			w := w.(http.ResponseWriter)
+	return func(c *octopus.Ctx) error {
+		if r, w := c.Request(), c.Response(); r != nil && w != nil {
 			h(w, r)
-			c.Next()
+			return c.Next()
 		}
+		return nil
 	}
 }
 
-// func HTTPMiddleware(h http.Handler) octopus.MiddlewareFunc {
-// 	return func(next octopus.HandlerFunc) octopus.HandlerFunc {
-// 		return func(c *octopus.Ctx) {
-// 			r, rok := c.Values.Get("request")
-// 			w, wok := c.Values.Get("response")
-// 			if !rok || !wok {
-// 				r := r.(*http.Request)
-// 				w := w.(http.ResponseWriter)
-// 				h.ServeHTTP(w, r)
-// 				next(c)
-// 			}
-// 		}
-// 	}
-// }
+// HTTPMiddleware runs a standard net/http middleware, such as those of
+// gorilla/handlers or chi, as part of an octopus chain. The rest of the chain
+// only runs if the middleware calls its next handler, and then sees the
+// request and ResponseWriter it was given. Errors from the rest of the chain
+// are handled there by the App's ErrorHandler, so that the middleware
+// observes the error response.
+//
+// The rest of the chain runs on a copy of the Ctx (see Ctx.Copy): some
+// middleware, like http.TimeoutHandler, call next from a goroutine that may
+// outlive the request.
+func HTTPMiddleware(mw func(http.Handler) http.Handler) octopus.HandlerFunc {
+	return func(c *octopus.Ctx) error {
+		if c.Request() == nil || c.Response() == nil {
+			return nil
+		}
+
+		cc := c.Copy()
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cc.SetRequest(r)
+			cc.SetResponse(w)
+			cc.Context = r.Context()
+			if err := cc.Next(); err != nil {
+				errorHandler(cc)(cc, err)
+			}
+		})
+		mw(next).ServeHTTP(cc.Response(), cc.Request())
+		return nil
+	}
+}
 
+// errorHandler returns the ErrorHandler of the App serving c.
+func errorHandler(c *octopus.Ctx) octopus.ErrorHandlerFunc {
+	if app := c.App(); app != nil && app.ErrorHandler != nil {
+		return app.ErrorHandler
+	}
+	return octopus.DefaultErrorHandler
+}
+
+// OctopusHandler turns an octopus handler into an http.Handler. When the
+// request comes from an octopus chain, through HTTPHandler or
+// HTTPMiddleware, h shares that request's Ctx values and App, so it sees the
+// same Store, error handlers and locals.
 func OctopusHandler(h octopus.HandlerFunc) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		c := octopus.NewCtx()
-		c.Values.Set("request", r)
-		c.Values.Set("response", w)
-		h(c)
-	})
+	return OctopusHandlerFunc(h)
 }
 
+// OctopusHandlerFunc is OctopusHandler returning an http.HandlerFunc.
 func OctopusHandlerFunc(h octopus.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		c := octopus.NewCtx()
-		c.Values.Set("request", r)
-		c.Values.Set("response", w)
-		h(c)
+		var c *octopus.Ctx
+		if parent, ok := octopus.FromContext(r.Context()); ok {
+			c = parent.App().NewCtx(w, r)
+			c.Values = parent.Values
+		} else {
+			c = octopus.NewCtx()
+			c.Context = r.Context()
+			c.SetRequest(r)
+			c.SetResponse(w)
+		}
+		if err := h(c); err != nil {
+			errorHandler(c)(c, err)
+		}
 	}
 }
 
-// func OctopusApp(app *octopus.app) http.Handler {
-// 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-// 	}
-// }
+// OctopusApp returns app as an http.Handler to be mounted in a net/http mux
+// or wrapped with HTTPHandler. When the request comes from another App, app
+// starts with the values that App set for it.
+func OctopusApp(app *octopus.App) http.Handler {
+	return app
+}
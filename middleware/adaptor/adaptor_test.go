@@ -0,0 +1,238 @@
+package adaptor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abdotop/octopus"
+)
+
+type ctxKey struct{}
+
+// statusRecorder is the kind of ResponseWriter wrapper logging middleware
+// installs.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	var recorded int
+	logging := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, "from middleware"))
+			r.Header.Set("X-Request-Id", "42")
+			next.ServeHTTP(rec, r)
+			recorded = rec.status
+		})
+	}
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	app := octopus.New()
+	app.Use(HTTPMiddleware(logging), HTTPMiddleware(auth))
+	var ran bool
+	app.Get("/ok", func(c *octopus.Ctx) error {
+		ran = true
+		req := c.Request()
+		if v := c.Context.Value(ctxKey{}); v != "from middleware" {
+			t.Errorf("Ctx.Context value = %v", v)
+		}
+		if req.Header.Get("X-Request-Id") != "42" {
+			t.Error("modified request not propagated")
+		}
+		return c.WriteString("ok")
+	})
+	app.Get("/missing", func(c *octopus.Ctx) error {
+		return octopus.NewError(octopus.StatusNotFound, "nothing here")
+	})
+
+	tests := []struct {
+		path     string
+		auth     bool
+		status   int
+		recorded int
+		ran      bool
+	}{
+		{"/ok", true, http.StatusOK, http.StatusOK, true},
+		{"/ok", false, http.StatusUnauthorized, http.StatusUnauthorized, false},
+		// The error goes through the middleware's writer
+		{"/missing", true, http.StatusNotFound, http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		ran, recorded = false, 0
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.auth {
+			req.Header.Set("Authorization", "Bearer x")
+		}
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, req)
+
+		if rr.Code != tt.status {
+			t.Errorf("%s auth=%v: status %d, want %d", tt.path, tt.auth, rr.Code, tt.status)
+		}
+		if recorded != tt.recorded {
+			t.Errorf("%s auth=%v: middleware recorded %d, want %d", tt.path, tt.auth, recorded, tt.recorded)
+		}
+		if ran != tt.ran {
+			t.Errorf("%s auth=%v: handler ran = %v", tt.path, tt.auth, ran)
+		}
+	}
+}
+
+func TestHTTPMiddlewareTimeout(t *testing.T) {
+	timeout := func(next http.Handler) http.Handler {
+		return http.TimeoutHandler(next, 10*time.Millisecond, "timeout")
+	}
+	release := make(chan struct{})
+	type seen struct {
+		id, user string
+		same     bool
+	}
+	result := make(chan seen, 1)
+
+	app := octopus.New()
+	app.Use(func(c *octopus.Ctx) error {
+		c.Values.Set("user", c.Query("user"))
+		return c.Next()
+	}, HTTPMiddleware(timeout))
+	app.Get("/slow/:id", func(c *octopus.Ctx) error {
+		<-release
+		// The request has timed out and its Ctx may serve another one by now
+		user, _ := c.Values.Get("user")
+		parent, _ := octopus.FromContext(c.Request().Context())
+		result <- seen{c.Param("id"), fmt.Sprint(user), parent == c}
+		return c.WriteString("too late")
+	})
+	app.Get("/fast/:id", func(c *octopus.Ctx) error {
+		return c.WriteString(c.Param("id"))
+	})
+
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, httptest.NewRequest("GET", "/slow/1?user=ana", nil))
+	if rr.Code != http.StatusServiceUnavailable || rr.Body.String() != "timeout" {
+		t.Fatalf("slow: got %d %q", rr.Code, rr.Body)
+	}
+	for i := 0; i < 10; i++ {
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, httptest.NewRequest("GET", "/fast/2?user=bob", nil))
+		if rr.Body.String() != "2" {
+			t.Fatalf("fast: got %d %q", rr.Code, rr.Body)
+		}
+	}
+	close(release)
+
+	select {
+	case got := <-result:
+		if got != (seen{"1", "ana", true}) {
+			t.Errorf("handler finishing after the timeout saw %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler did not finish after the timeout")
+	}
+}
+
+func TestOctopusHandler(t *testing.T) {
+	inner := func(c *octopus.Ctx) error {
+		user, _ := c.Values.Get("user")
+		store, err := c.AppStore()
+		if err != nil {
+			return c.WriteString("no app")
+		}
+		name, _ := store.Get("name")
+		c.Values.Set("seen", true)
+		if c.Query("fail") != "" {
+			return octopus.NewError(octopus.StatusTeapot)
+		}
+		return c.WriteString(fmt.Sprint(user, "@", name))
+	}
+
+	app := octopus.New()
+	app.Store.Set("name", "main")
+	app.OnErrorCode(octopus.StatusTeapot, func(c *octopus.Ctx) error {
+		return c.WriteString("custom teapot")
+	})
+	app.Use(func(c *octopus.Ctx) error {
+		c.Values.Set("user", "ana")
+		return c.Next()
+	})
+	var seen interface{}
+	app.Get("/wrapped", HTTPHandler(OctopusHandler(inner)), func(c *octopus.Ctx) error {
+		seen, _ = c.Values.Get("seen")
+		return nil
+	})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		target  string
+		status  int
+		body    string
+	}{
+		{"inside an app", app, "/wrapped", http.StatusOK, "ana@main"},
+		{"error handler of the app", app, "/wrapped?fail=1", http.StatusTeapot, "custom teapot"},
+		{"standalone", OctopusHandler(inner), "/", http.StatusOK, "no app"},
+	}
+	for _, tt := range tests {
+		seen = nil
+		rr := httptest.NewRecorder()
+		tt.handler.ServeHTTP(rr, httptest.NewRequest("GET", tt.target, nil))
+		if rr.Code != tt.status || rr.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, rr.Code, rr.Body, tt.status, tt.body)
+		}
+	}
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, httptest.NewRequest("GET", "/wrapped", nil))
+	if seen != true {
+		t.Error("values set by the adapted handler are not visible to the chain")
+	}
+}
+
+func TestOctopusApp(t *testing.T) {
+	sub := octopus.New()
+	sub.Get("/", func(c *octopus.Ctx) error {
+		user, _ := c.Values.Get("user")
+		return c.WriteString(fmt.Sprint("sub sees ", user))
+	})
+
+	app := octopus.New()
+	app.Use(func(c *octopus.Ctx) error {
+		c.Values.Set("user", "ana")
+		return c.Next()
+	})
+	app.Get("/", HTTPHandler(OctopusApp(sub)))
+	app.Get("/std", HTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := octopus.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "no ctx", http.StatusInternalServerError)
+			return
+		}
+		user, _ := c.Values.Get("user")
+		fmt.Fprint(w, "std sees ", user)
+	}))
+
+	for target, want := range map[string]string{"/": "sub sees ana", "/std": "std sees ana"} {
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Body.String() != want {
+			t.Errorf("%s: got %q, want %q", target, rr.Body, want)
+		}
+	}
+}
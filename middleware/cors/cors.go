@@ -2,6 +2,7 @@ package cors
 
 import (
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -10,24 +11,43 @@ import (
 
 // Config defines the config for CORS middleware.
 type Config struct {
-	// allow origin
+	// AllowedOrigins lists the origins allowed to make cross-origin
+	// requests: exact origins such as "https://example.com", wildcard
+	// subdomains such as "https://*.example.com", or "*" for any origin.
 	AllowedOrigins []string
+	// AllowedOriginPatterns are regular expressions matched against the
+	// whole origin.
+	AllowedOriginPatterns []string
+	// AllowOriginFunc, when set, is consulted for origins not matched by
+	// AllowedOrigins or AllowedOriginPatterns.
+	AllowOriginFunc func(origin string) bool
+
 	// allow methods
 	AllowedMethods []string
-	// allow headers
+	// AllowedHeaders lists the request headers allowed in preflights. "*"
+	// allows any header.
 	AllowedHeaders []string
-	// allow credentials
+	// AllowCredentials lets the browser send cookies. The matched origin is
+	// then always reflected, never "*".
 	AllowCredentials bool
 	// expose headers
 	ExposedHeaders []string
-	// max age
+	// MaxAge is how long, in seconds, a preflight can be cached. Defaults to
+	// 24 hours; a negative value omits the header.
 	MaxAge int
+
+	// AllowPrivateNetwork answers Private Network Access preflights sent by
+	// public pages to this server.
+	AllowPrivateNetwork bool
+	// OptionsPassthrough hands preflights to the next handlers instead of
+	// answering them with 204.
+	OptionsPassthrough bool
 }
 
 // New returns a new CORS middleware.
 func New(config Config) octopus.HandlerFunc {
 	// Defaults for config
-	if len(config.AllowedOrigins) == 0 {
+	if len(config.AllowedOrigins) == 0 && len(config.AllowedOriginPatterns) == 0 && config.AllowOriginFunc == nil {
 		config.AllowedOrigins = []string{"*"}
 	}
 	if len(config.AllowedMethods) == 0 {
@@ -36,34 +56,193 @@ func New(config Config) octopus.HandlerFunc {
 	if len(config.AllowedHeaders) == 0 {
 		config.AllowedHeaders = []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization"}
 	}
-	if len(config.ExposedHeaders) == 0 {
-		config.ExposedHeaders = []string{}
-	}
 	if config.MaxAge == 0 {
 		config.MaxAge = 86400 // 24 hours
 	}
 
-	// return middleware octopus handler func with config
-	return func(c *octopus.Ctx) {
-		w, ok := c.Values.Get("response")
-		if ok {
-			w := w.(http.ResponseWriter)
-			w.Header().Set("Access-Control-Allow-Origin", strings.Join(config.AllowedOrigins, ","))
-			w.Header().Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ","))
-			w.Header().Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ","))
-			w.Header().Set("Access-Control-Allow-Credentials", strconv.FormatBool(config.AllowCredentials))
-			w.Header().Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ","))
-			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(config.MaxAge))
-			r, ok := c.Values.Get("request")
-			if ok {
-				r := r.(*http.Request)
-				if r.Method == "OPTIONS" {
-					w.WriteHeader(http.StatusOK)
-					return
-				}
+	p := newPolicy(config)
+	return func(c *octopus.Ctx) error {
+		w, r := c.Response(), c.Request()
+		if w == nil || r == nil {
+			return c.Next()
+		}
+
+		if isPreflight(r) {
+			p.preflight(w, r)
+			if config.OptionsPassthrough {
+				return c.Next()
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+		p.actual(w, r)
+		return c.Next()
+	}
+}
+
+// isPreflight tells a preflight from other OPTIONS requests.
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// policy is a Config compiled for matching.
+type policy struct {
+	config      Config
+	anyOrigin   bool
+	origins     map[string]bool
+	wildcards   [][2]string // scheme://, .domain
+	patterns    []*regexp.Regexp
+	methods     map[string]bool
+	anyHeader   bool
+	headers     map[string]bool
+	allowMethod string
+	expose      string
+}
+
+func newPolicy(config Config) *policy {
+	p := &policy{
+		config:  config,
+		origins: make(map[string]bool),
+		methods: make(map[string]bool),
+		headers: make(map[string]bool),
+		expose:  strings.Join(config.ExposedHeaders, ", "),
+	}
+	for _, o := range config.AllowedOrigins {
+		o = strings.ToLower(o)
+		switch {
+		case o == "*":
+			p.anyOrigin = true
+		case strings.Contains(o, "://*."):
+			scheme, domain, _ := strings.Cut(o, "*")
+			p.wildcards = append(p.wildcards, [2]string{scheme, domain})
+		default:
+			p.origins[o] = true
+		}
+	}
+	for _, pattern := range config.AllowedOriginPatterns {
+		p.patterns = append(p.patterns, regexp.MustCompile("^(?:"+pattern+")$"))
+	}
+	for _, m := range config.AllowedMethods {
+		p.methods[strings.ToUpper(m)] = true
+	}
+	p.allowMethod = strings.Join(config.AllowedMethods, ", ")
+	for _, h := range config.AllowedHeaders {
+		if h == "*" {
+			p.anyHeader = true
+		}
+		p.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	return p
+}
+
+// allowOrigin reports whether origin may access the resource.
+func (p *policy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if p.origins[lower] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) &&
+			len(lower) > len(w[0])+len(w[1]) {
+			return true
+		}
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return p.config.AllowOriginFunc != nil && p.config.AllowOriginFunc(origin)
+}
+
+// allowOriginValue is the Access-Control-Allow-Origin value for origin: "*"
+// only when any origin is allowed without credentials.
+func (p *policy) allowOriginValue(origin string) string {
+	if p.anyOrigin && !p.config.AllowCredentials {
+		return "*"
+	}
+	return origin
+}
+
+// varyOrigin reports whether responses depend on the Origin header.
+func (p *policy) varyOrigin() bool {
+	return !p.anyOrigin || p.config.AllowCredentials
+}
+
+func (p *policy) preflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	if r.Header.Get("Access-Control-Request-Private-Network") != "" {
+		h.Add("Vary", "Access-Control-Request-Private-Network")
+	}
+
+	origin := r.Header.Get("Origin")
+	if !p.allowOrigin(origin) {
+		return
+	}
+	if !p.methods[strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))] {
+		return
+	}
+	requested, ok := p.allowHeaders(r.Header.Values("Access-Control-Request-Headers"))
+	if !ok {
+		return
+	}
+
+	h.Set("Access-Control-Allow-Origin", p.allowOriginValue(origin))
+	h.Set("Access-Control-Allow-Methods", p.allowMethod)
+	if len(requested) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if p.config.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if p.config.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(p.config.MaxAge))
+	}
+	if p.config.AllowPrivateNetwork && r.Header.Get("Access-Control-Request-Private-Network") == "true" {
+		h.Set("Access-Control-Allow-Private-Network", "true")
+	}
+}
+
+// allowHeaders returns the requested headers if all of them are allowed.
+func (p *policy) allowHeaders(values []string) ([]string, bool) {
+	var requested []string
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
 			}
+			if !p.anyHeader && !p.headers[name] {
+				return nil, false
+			}
+			requested = append(requested, name)
 		}
+	}
+	return requested, true
+}
 
-		c.Next()
+func (p *policy) actual(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	if p.varyOrigin() {
+		h.Add("Vary", "Origin")
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" || !p.allowOrigin(origin) {
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", p.allowOriginValue(origin))
+	if p.config.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if p.expose != "" {
+		h.Set("Access-Control-Expose-Headers", p.expose)
 	}
 }
@@ -3,41 +3,297 @@ package cors
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/abdotop/octopus"
 )
 
 func TestCORSMiddleware(t *testing.T) {
-	app := octopus.New()
-
-	app.Use(New(Config{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization"},
-		AllowCredentials: true,
-		ExposedHeaders:   []string{},
-		MaxAge:           86400,
-	}))
-
-	app.Get("/test", func(c *octopus.Ctx) {})
+	exact := Config{AllowedOrigins: []string{"https://example.com"}}
+	credentials := Config{AllowedOrigins: []string{"*"}, AllowCredentials: true, ExposedHeaders: []string{"X-Total"}}
 
-	req, err := http.NewRequest("GET", "http://localhost:8888/test", nil)
-	if err != nil {
-		t.Fatal(err)
+	tests := []struct {
+		name    string
+		config  Config
+		method  string
+		headers map[string]string
+		status  int
+		want    map[string]string // "" means the header must be absent
+		vary    []string
+		handled bool // the route handler ran
+	}{
+		{
+			name:    "no origin",
+			config:  exact,
+			method:  "GET",
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": ""},
+			vary:    []string{"Origin"},
+			handled: true,
+		},
+		{
+			name:    "exact origin",
+			config:  exact,
+			method:  "GET",
+			headers: map[string]string{"Origin": "https://example.com"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": "https://example.com", "Access-Control-Allow-Credentials": ""},
+			vary:    []string{"Origin"},
+			handled: true,
+		},
+		{
+			name:    "disallowed origin",
+			config:  exact,
+			method:  "GET",
+			headers: map[string]string{"Origin": "https://evil.com"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": ""},
+			vary:    []string{"Origin"},
+			handled: true,
+		},
+		{
+			name:    "several origins reflect only the match",
+			config:  Config{AllowedOrigins: []string{"https://a.com", "https://b.com"}},
+			method:  "GET",
+			headers: map[string]string{"Origin": "https://b.com"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": "https://b.com"},
+			handled: true,
+		},
+		{
+			name:    "wildcard subdomain",
+			config:  Config{AllowedOrigins: []string{"https://*.example.com"}},
+			method:  "GET",
+			headers: map[string]string{"Origin": "https://api.example.com"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": "https://api.example.com"},
+			handled: true,
+		},
+		{
+			name:    "wildcard subdomain excludes apex and lookalikes",
+			config:  Config{AllowedOrigins: []string{"https://*.example.com"}},
+			method:  "GET",
+			headers: map[string]string{"Origin": "https://evilexample.com"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": ""},
+			handled: true,
+		},
+		{
+			name:    "regex",
+			config:  Config{AllowedOriginPatterns: []string{`http://localhost:\d+`}},
+			method:  "GET",
+			headers: map[string]string{"Origin": "http://localhost:3000"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": "http://localhost:3000"},
+			handled: true,
+		},
+		{
+			name:    "regex is anchored",
+			config:  Config{AllowedOriginPatterns: []string{`http://localhost:\d+`}},
+			method:  "GET",
+			headers: map[string]string{"Origin": "http://localhost:3000.evil.com"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": ""},
+			handled: true,
+		},
+		{
+			name: "callback",
+			config: Config{AllowOriginFunc: func(origin string) bool {
+				return strings.HasSuffix(origin, ".internal")
+			}},
+			method:  "GET",
+			headers: map[string]string{"Origin": "http://app.internal"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": "http://app.internal"},
+			handled: true,
+		},
+		{
+			name:    "any origin without credentials",
+			config:  Config{},
+			method:  "GET",
+			headers: map[string]string{"Origin": "https://x.com"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": "*"},
+			vary:    []string{},
+			handled: true,
+		},
+		{
+			name:    "any origin with credentials reflects the origin",
+			config:  credentials,
+			method:  "GET",
+			headers: map[string]string{"Origin": "https://x.com"},
+			status:  http.StatusOK,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://x.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Total",
+				"Access-Control-Allow-Methods":     "",
+			},
+			vary:    []string{"Origin"},
+			handled: true,
+		},
+		{
+			name:   "preflight",
+			config: Config{AllowedOrigins: []string{"https://example.com"}, AllowedHeaders: []string{"Content-Type", "X-Token"}, MaxAge: 600},
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  "PUT",
+				"Access-Control-Request-Headers": "content-type, x-token",
+			},
+			status: http.StatusNoContent,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":  "https://example.com",
+				"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
+				"Access-Control-Allow-Headers": "Content-Type, X-Token",
+				"Access-Control-Max-Age":       "600",
+			},
+			vary: []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name:   "preflight with a disallowed method",
+			config: Config{AllowedOrigins: []string{"https://example.com"}, AllowedMethods: []string{"GET"}},
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                        "https://example.com",
+				"Access-Control-Request-Method": "DELETE",
+			},
+			status: http.StatusNoContent,
+			want:   map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+		{
+			name:   "preflight with a disallowed header",
+			config: exact,
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "X-Secret",
+			},
+			status: http.StatusNoContent,
+			want:   map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:   "preflight from a disallowed origin",
+			config: exact,
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                        "https://evil.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			status: http.StatusNoContent,
+			want:   map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:   "preflight with any header",
+			config: Config{AllowedHeaders: []string{"*"}},
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                         "https://x.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "x-anything",
+			},
+			status: http.StatusNoContent,
+			want:   map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Headers": "X-Anything"},
+		},
+		{
+			name:   "private network",
+			config: Config{AllowedOrigins: []string{"https://example.com"}, AllowPrivateNetwork: true},
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                                 "https://example.com",
+				"Access-Control-Request-Method":          "GET",
+				"Access-Control-Request-Private-Network": "true",
+			},
+			status: http.StatusNoContent,
+			want:   map[string]string{"Access-Control-Allow-Private-Network": "true"},
+			vary:   []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers", "Access-Control-Request-Private-Network"},
+		},
+		{
+			name:   "private network not allowed",
+			config: exact,
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                                 "https://example.com",
+				"Access-Control-Request-Method":          "GET",
+				"Access-Control-Request-Private-Network": "true",
+			},
+			status: http.StatusNoContent,
+			want:   map[string]string{"Access-Control-Allow-Origin": "https://example.com", "Access-Control-Allow-Private-Network": ""},
+		},
+		{
+			name:    "OPTIONS without Access-Control-Request-Method is not a preflight",
+			config:  exact,
+			method:  "OPTIONS",
+			headers: map[string]string{"Origin": "https://example.com"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": "https://example.com", "Access-Control-Allow-Methods": ""},
+			handled: true,
+		},
+		{
+			name:   "preflight passthrough",
+			config: Config{AllowedOrigins: []string{"https://example.com"}, OptionsPassthrough: true},
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                        "https://example.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": "https://example.com"},
+			handled: true,
+		},
 	}
 
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(app.ServeHTTP)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := octopus.New()
+			app.Use(New(tt.config))
+			handled := false
+			app.Any("/test", func(c *octopus.Ctx) error {
+				handled = true
+				return c.WriteString("ok")
+			})
 
-	handler.ServeHTTP(rr, req)
+			req := httptest.NewRequest(tt.method, "http://localhost:8888/test", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			app.ServeHTTP(rr, req)
 
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+			if rr.Code != tt.status {
+				t.Errorf("status = %d, want %d", rr.Code, tt.status)
+			}
+			if handled != tt.handled {
+				t.Errorf("handler ran = %v, want %v", handled, tt.handled)
+			}
+			for name, want := range tt.want {
+				if got := rr.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if tt.vary != nil {
+				if got := rr.Header().Values("Vary"); strings.Join(got, ",") != strings.Join(tt.vary, ",") {
+					t.Errorf("Vary = %v, want %v", got, tt.vary)
+				}
+			}
+		})
 	}
+}
+
+func TestPreflightWithoutOptionsRoute(t *testing.T) {
+	app := octopus.New()
+	app.Use(New(Config{AllowedOrigins: []string{"https://example.com"}}))
+	app.Post("/items", func(c *octopus.Ctx) error { return c.WriteString("created") })
+
+	req := httptest.NewRequest("OPTIONS", "/items", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, req)
 
-	expected := "*"
-	if rr.Header().Get("Access-Control-Allow-Origin") != expected {
-		t.Errorf("handler returned unexpected Access-Control-Allow-Origin header: got %v want %v", rr.Header().Get("Access-Control-Allow-Origin"), expected)
+	if rr.Code != http.StatusNoContent || rr.Header().Get("Access-Control-Allow-Origin") != "https://example.com" {
+		t.Errorf("got %d, Access-Control-Allow-Origin %q", rr.Code, rr.Header().Get("Access-Control-Allow-Origin"))
 	}
 }
@@ -0,0 +1,185 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS decodes a JWKS document into a map of "kid" to verification
+// keys. RSA, Ed25519 (OKP) and symmetric (oct) keys are supported; other
+// keys and keys meant for encryption are skipped.
+func ParseJWKS(data []byte) (map[string]interface{}, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("jwt: invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var (
+			key interface{}
+			err error
+		)
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k)
+		case "OKP":
+			if k.Crv != "Ed25519" {
+				continue
+			}
+			var x []byte
+			x, err = base64.RawURLEncoding.DecodeString(k.X)
+			if err == nil && len(x) != ed25519.PublicKeySize {
+				err = fmt.Errorf("bad Ed25519 key size %d", len(x))
+			}
+			key = ed25519.PublicKey(x)
+		case "oct":
+			key, err = base64.RawURLEncoding.DecodeString(k.K)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jwt: invalid JWKS key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func rsaKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	exp := new(big.Int).SetBytes(e)
+	if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("exponent too large")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
+
+// keySet caches the keys of a JWKS document and reloads it when a token
+// references an unknown "kid", at most once per refresh interval. Reloads
+// happen outside of mu, so tokens with known keys are never held up by one.
+type keySet struct {
+	mu       sync.RWMutex
+	source   string
+	refresh  time.Duration
+	keys     map[string]interface{}
+	loadedAt time.Time
+	loading  chan struct{} // closed when the reload in flight ends
+	loadErr  error         // result of the last reload
+}
+
+func (ks *keySet) get(kid string) (interface{}, error) {
+	ks.mu.RLock()
+	key, ok := ks.keys[kid]
+	stale := time.Since(ks.loadedAt) >= ks.refresh
+	ks.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, ErrUnknownKey
+	}
+
+	if err := ks.load(); err != nil {
+		return nil, err
+	}
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if key, ok := ks.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// load reloads the set. Concurrent callers wait for the same reload instead
+// of starting their own.
+func (ks *keySet) load() error {
+	ks.mu.Lock()
+	// Another request may have reloaded the set while we waited for the lock
+	if ks.keys != nil && time.Since(ks.loadedAt) < ks.refresh {
+		ks.mu.Unlock()
+		return nil
+	}
+	if done := ks.loading; done != nil {
+		ks.mu.Unlock()
+		<-done
+		ks.mu.RLock()
+		defer ks.mu.RUnlock()
+		return ks.loadErr
+	}
+	done := make(chan struct{})
+	ks.loading = done
+	ks.mu.Unlock()
+
+	keys, err := fetchJWKS(ks.source)
+
+	ks.mu.Lock()
+	ks.loadedAt = time.Now()
+	ks.loadErr = err
+	if err == nil {
+		ks.keys = keys
+	}
+	ks.loading = nil
+	ks.mu.Unlock()
+	close(done)
+	return err
+}
+
+func fetchJWKS(source string) (map[string]interface{}, error) {
+	data, err := readSource(source)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: loading JWKS: %w", err)
+	}
+	return ParseJWKS(data)
+}
+
+// readSource reads a JWKS document from a URL or a local file.
+func readSource(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
@@ -1 +1,217 @@
 package jwt
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abdotop/octopus"
+)
+
+// Config defines the config for JWT middleware.
+type Config struct {
+	// Key verifies tokens that carry no "kid" header: a []byte secret for
+	// the HS algorithms, an *rsa.PublicKey for RS256 or an
+	// ed25519.PublicKey for EdDSA.
+	Key interface{}
+	// Keys maps "kid" header values to verification keys, for rotation.
+	Keys map[string]interface{}
+	// JWKS is a file path or an http(s) URL to a JWKS document. It is used
+	// for kids missing from Keys and reloaded when an unknown kid shows up.
+	JWKS string
+	// JWKSRefresh is the minimum delay between two JWKS reloads.
+	// Defaults to 5 minutes.
+	JWKSRefresh time.Duration
+	// Algorithms restricts the accepted "alg" values. Defaults to all the
+	// supported algorithms.
+	Algorithms []string
+	// TokenLookup lists where to look for the token, as comma separated
+	// "header:<name>", "cookie:<name>" or "query:<name>" sources tried in
+	// order. Defaults to "header:Authorization".
+	TokenLookup string
+	// AuthScheme is the prefix stripped from tokens read from the
+	// Authorization header. Defaults to "Bearer". Other headers carry the
+	// bare token.
+	AuthScheme string
+	// Issuer, when set, must equal the "iss" claim.
+	Issuer string
+	// Audience, when set, must be one of the "aud" claim values.
+	Audience string
+	// ClockSkew is the leeway applied to "exp" and "nbf".
+	ClockSkew time.Duration
+}
+
+var (
+	errMissingToken = errors.New("jwt: missing or malformed token")
+	errInvalidToken = errors.New("jwt: invalid or expired token")
+)
+
+var claimsKey = octopus.NewKey[Claims]("jwt.claims")
+
+// New returns a middleware that rejects requests without a valid token
+// with StatusUnauthorized and stores the claims of valid ones on the Ctx,
+// where FromCtx reads them.
+func New(config Config) octopus.HandlerFunc {
+	v := newVerifier(config)
+	return func(c *octopus.Ctx) error {
+		r := c.Request()
+		if r == nil {
+			return octopus.NewError(octopus.StatusUnauthorized, errMissingToken.Error())
+		}
+		token := v.extract(r)
+		if token == "" {
+			return octopus.NewError(octopus.StatusUnauthorized, errMissingToken.Error())
+		}
+		claims, err := v.parse(token)
+		if err != nil {
+			// The cause, such as a JWKS fetch error, stays in the logs
+			log.Printf("octopus: %v", err)
+			return octopus.NewError(octopus.StatusUnauthorized, errInvalidToken.Error())
+		}
+		octopus.SetLocal(c, claimsKey, claims)
+		return c.Next()
+	}
+}
+
+// FromCtx returns the claims stored by the middleware.
+func FromCtx(c *octopus.Ctx) (Claims, bool) {
+	return octopus.Locals(c, claimsKey)
+}
+
+// Parse verifies token against config and returns its claims. The
+// middleware keeps its JWKS between requests; Parse loads it on each call.
+func Parse(token string, config Config) (Claims, error) {
+	return newVerifier(config).parse(token)
+}
+
+type verifier struct {
+	config  Config
+	jwks    *keySet
+	sources [][2]string
+}
+
+func newVerifier(config Config) *verifier {
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = []string{HS256, HS384, HS512, RS256, EdDSA}
+	}
+	if config.TokenLookup == "" {
+		config.TokenLookup = "header:Authorization"
+	}
+	if config.AuthScheme == "" {
+		config.AuthScheme = "Bearer"
+	}
+	if config.JWKSRefresh == 0 {
+		config.JWKSRefresh = 5 * time.Minute
+	}
+
+	v := &verifier{config: config}
+	if config.JWKS != "" {
+		v.jwks = &keySet{source: config.JWKS, refresh: config.JWKSRefresh}
+	}
+	for _, source := range strings.Split(config.TokenLookup, ",") {
+		kind, name, ok := strings.Cut(strings.TrimSpace(source), ":")
+		if ok {
+			v.sources = append(v.sources, [2]string{kind, name})
+		}
+	}
+	return v
+}
+
+func (v *verifier) extract(r *http.Request) string {
+	for _, source := range v.sources {
+		var token string
+		switch source[0] {
+		case "header":
+			token = r.Header.Get(source[1])
+			if strings.EqualFold(source[1], "Authorization") {
+				prefix := v.config.AuthScheme + " "
+				if len(token) <= len(prefix) || !strings.EqualFold(token[:len(prefix)], prefix) {
+					token = ""
+				} else {
+					token = strings.TrimSpace(token[len(prefix):])
+				}
+			}
+		case "cookie":
+			if cookie, err := r.Cookie(source[1]); err == nil {
+				token = cookie.Value
+			}
+		case "query":
+			token = r.URL.Query().Get(source[1])
+		}
+		if token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+func (v *verifier) parse(token string) (Claims, error) {
+	h, claims, sig, signingInput, err := decode(token)
+	if err != nil {
+		return nil, err
+	}
+	if !v.allowed(h.Alg) {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	key, err := v.key(h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(h.Alg, key, []byte(signingInput), sig); err != nil {
+		return nil, err
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *verifier) allowed(alg string) bool {
+	for _, a := range v.config.Algorithms {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *verifier) key(kid string) (interface{}, error) {
+	if kid == "" || (v.config.Keys == nil && v.jwks == nil) {
+		if v.config.Key == nil {
+			return nil, ErrUnknownKey
+		}
+		return v.config.Key, nil
+	}
+	if key, ok := v.config.Keys[kid]; ok {
+		return key, nil
+	}
+	if v.jwks != nil {
+		return v.jwks.get(kid)
+	}
+	return nil, ErrUnknownKey
+}
+
+func (v *verifier) validate(claims Claims) error {
+	now := time.Now()
+	skew := v.config.ClockSkew
+	if exp, ok := claims.ExpiresAt(); ok && !now.Before(exp.Add(skew)) {
+		return ErrExpired
+	}
+	if nbf, ok := claims.NotBefore(); ok && now.Add(skew).Before(nbf) {
+		return ErrNotYetValid
+	}
+	if v.config.Issuer != "" && claims.Issuer() != v.config.Issuer {
+		return ErrInvalidIssuer
+	}
+	if v.config.Audience != "" {
+		for _, aud := range claims.Audience() {
+			if aud == v.config.Audience {
+				return nil
+			}
+		}
+		return ErrInvalidAudience
+	}
+	return nil
+}
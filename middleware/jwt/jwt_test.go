@@ -0,0 +1,259 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abdotop/octopus"
+)
+
+var secret = []byte("top-secret")
+
+func mustSign(t *testing.T, alg, kid string, key interface{}, claims Claims) string {
+	t.Helper()
+	token, err := Sign(alg, kid, key, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestMiddleware(t *testing.T) {
+	app := octopus.New()
+	app.Use(New(Config{Key: secret, TokenLookup: "header:Authorization,header:X-Auth-Token,cookie:jwt,query:token"}))
+	app.Get("/me", func(c *octopus.Ctx) error {
+		claims, _ := FromCtx(c)
+		return c.WriteString(claims.Subject())
+	})
+
+	token := mustSign(t, HS256, "", secret, Claims{"sub": "42", "exp": time.Now().Add(time.Hour).Unix()})
+
+	header := httptest.NewRequest("GET", "/me", nil)
+	header.Header.Set("Authorization", "Bearer "+token)
+	custom := httptest.NewRequest("GET", "/me", nil)
+	custom.Header.Set("X-Auth-Token", token)
+	cookie := httptest.NewRequest("GET", "/me", nil)
+	cookie.AddCookie(&http.Cookie{Name: "jwt", Value: token})
+	query := httptest.NewRequest("GET", "/me?token="+token, nil)
+	missing := httptest.NewRequest("GET", "/me", nil)
+	bad := httptest.NewRequest("GET", "/me", nil)
+	bad.Header.Set("Authorization", "Bearer "+token+"x")
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+		body   string
+	}{
+		{"header", header, http.StatusOK, "42"},
+		{"bare token in a custom header", custom, http.StatusOK, "42"},
+		{"cookie", cookie, http.StatusOK, "42"},
+		{"query", query, http.StatusOK, "42"},
+		{"missing", missing, http.StatusUnauthorized, errMissingToken.Error()},
+		{"bad signature", bad, http.StatusUnauthorized, errInvalidToken.Error()},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, tt.req)
+		if rr.Code != tt.status || rr.Body.String() != tt.body {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, rr.Code, rr.Body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+func TestAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{Keys: map[string]interface{}{
+		"hs":  secret,
+		"rsa": &rsaKey.PublicKey,
+		"ed":  edPub,
+	}}
+
+	for _, tc := range []struct {
+		alg, kid string
+		key      interface{}
+	}{
+		{HS256, "hs", secret},
+		{HS384, "hs", secret},
+		{HS512, "hs", secret},
+		{RS256, "rsa", rsaKey},
+		{EdDSA, "ed", edPriv},
+	} {
+		token := mustSign(t, tc.alg, tc.kid, tc.key, Claims{"sub": tc.alg})
+		claims, err := Parse(token, config)
+		if err != nil || claims.Subject() != tc.alg {
+			t.Errorf("%s: got %v, %v", tc.alg, claims, err)
+		}
+	}
+
+	// An RSA key must not be usable as an HMAC secret.
+	token := mustSign(t, HS256, "rsa", secret, Claims{})
+	if _, err := Parse(token, config); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("algorithm confusion: got %v, want %v", err, ErrInvalidKey)
+	}
+
+	// Unsigned tokens are rejected.
+	none := encode([]byte(`{"alg":"none"}`)) + "." + encode([]byte(`{}`)) + "."
+	if _, err := Parse(none, Config{Key: secret}); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Errorf("alg none: got %v, want %v", err, ErrUnsupportedAlgorithm)
+	}
+
+	// Algorithms restricts what is accepted.
+	token = mustSign(t, HS512, "", secret, Claims{})
+	if _, err := Parse(token, Config{Key: secret, Algorithms: []string{HS256}}); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Errorf("restricted algorithms: got %v", err)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	now := time.Now()
+	config := Config{Key: secret, Issuer: "octopus", Audience: "api", ClockSkew: time.Minute}
+
+	tests := []struct {
+		name   string
+		claims Claims
+		err    error
+	}{
+		{"valid", Claims{"iss": "octopus", "aud": "api", "exp": now.Add(time.Hour).Unix()}, nil},
+		{"audience list", Claims{"iss": "octopus", "aud": []string{"web", "api"}}, nil},
+		{"expired", Claims{"iss": "octopus", "aud": "api", "exp": now.Add(-2 * time.Minute).Unix()}, ErrExpired},
+		{"expired within skew", Claims{"iss": "octopus", "aud": "api", "exp": now.Add(-30 * time.Second).Unix()}, nil},
+		{"not yet valid", Claims{"iss": "octopus", "aud": "api", "nbf": now.Add(2 * time.Minute).Unix()}, ErrNotYetValid},
+		{"nbf within skew", Claims{"iss": "octopus", "aud": "api", "nbf": now.Add(30 * time.Second).Unix()}, nil},
+		{"issuer", Claims{"iss": "other", "aud": "api"}, ErrInvalidIssuer},
+		{"audience", Claims{"iss": "octopus", "aud": "web"}, ErrInvalidAudience},
+	}
+	for _, tt := range tests {
+		_, err := Parse(mustSign(t, HS256, "", secret, tt.claims), config)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	doc, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": b64(edPub)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, doc, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write(doc)
+	}))
+	defer srv.Close()
+
+	rsaToken := mustSign(t, RS256, "rsa-1", rsaKey, Claims{"sub": "rsa"})
+	edToken := mustSign(t, EdDSA, "ed-1", edPriv, Claims{"sub": "ed"})
+	unknown := mustSign(t, EdDSA, "ed-2", edPriv, Claims{"sub": "ed"})
+
+	for _, source := range []string{file, srv.URL} {
+		v := newVerifier(Config{JWKS: source})
+		for _, token := range []string{rsaToken, edToken} {
+			if _, err := v.parse(token); err != nil {
+				t.Errorf("%s: %v", source, err)
+			}
+		}
+		if _, err := v.parse(unknown); !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("%s: unknown kid: got %v", source, err)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", hits)
+	}
+}
+
+func TestJWKSReload(t *testing.T) {
+	doc := []byte(`{"keys":[{"kty":"oct","kid":"hs-1","k":"` + base64.RawURLEncoding.EncodeToString(secret) + `"}]}`)
+	var hits atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first fetch answers at once, reloads hang until released
+		if hits.Add(1) > 1 {
+			<-release
+		}
+		w.Write(doc)
+	}))
+	defer srv.Close()
+
+	v := newVerifier(Config{JWKS: srv.URL, JWKSRefresh: time.Nanosecond})
+	known := mustSign(t, HS256, "hs-1", secret, Claims{"sub": "42"})
+	unknown := mustSign(t, HS256, "hs-2", secret, Claims{"sub": "42"})
+	if _, err := v.parse(known); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.parse(unknown); !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("unknown kid: got %v", err)
+			}
+		}()
+	}
+	for hits.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Known keys verify while the reload is in flight
+	parsed := make(chan error, 1)
+	go func() {
+		_, err := v.parse(known)
+		parsed <- err
+	}()
+	select {
+	case err := <-parsed:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("known kid blocked by the JWKS reload")
+	}
+
+	// Let every goroutine reach the reload before it ends
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := hits.Load(); n != 2 {
+		t.Errorf("JWKS fetched %d times, want concurrent reloads to share one fetch", n)
+	}
+}
@@ -0,0 +1,244 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash"
+	"strings"
+	"time"
+)
+
+// Supported signing algorithms.
+const (
+	HS256 = "HS256"
+	HS384 = "HS384"
+	HS512 = "HS512"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+var (
+	ErrMalformed            = errors.New("jwt: malformed token")
+	ErrUnsupportedAlgorithm = errors.New("jwt: unsupported algorithm")
+	ErrUnknownKey           = errors.New("jwt: no key for token")
+	ErrInvalidKey           = errors.New("jwt: key type does not match algorithm")
+	ErrInvalidSignature     = errors.New("jwt: invalid signature")
+	ErrExpired              = errors.New("jwt: token is expired")
+	ErrNotYetValid          = errors.New("jwt: token is not valid yet")
+	ErrInvalidIssuer        = errors.New("jwt: invalid issuer")
+	ErrInvalidAudience      = errors.New("jwt: invalid audience")
+)
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Claims is the decoded payload of a token. Numbers decode as float64, as
+// with encoding/json.
+type Claims map[string]interface{}
+
+// Issuer returns the "iss" claim.
+func (c Claims) Issuer() string {
+	s, _ := c["iss"].(string)
+	return s
+}
+
+// Subject returns the "sub" claim.
+func (c Claims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+// Audience returns the "aud" claim, which may be a string or a list.
+func (c Claims) Audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		out := make([]string, 0, len(aud))
+		for _, v := range aud {
+			if s, ok := v.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	case []string:
+		return aud
+	}
+	return nil
+}
+
+// ExpiresAt returns the "exp" claim and whether it is set.
+func (c Claims) ExpiresAt() (time.Time, bool) {
+	return c.time("exp")
+}
+
+// NotBefore returns the "nbf" claim and whether it is set.
+func (c Claims) NotBefore() (time.Time, bool) {
+	return c.time("nbf")
+}
+
+// IssuedAt returns the "iat" claim and whether it is set.
+func (c Claims) IssuedAt() (time.Time, bool) {
+	return c.time("iat")
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case int64:
+		return time.Unix(v, 0), true
+	case int:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		n, err := v.Int64()
+		return time.Unix(n, 0), err == nil
+	}
+	return time.Time{}, false
+}
+
+// Sign encodes claims as a compact JWS signed with key. key must be a
+// []byte for the HS algorithms, an *rsa.PrivateKey for RS256 and an
+// ed25519.PrivateKey for EdDSA. A non-empty kid is written to the header so
+// verifiers can select the matching key.
+func Sign(alg, kid string, key interface{}, claims Claims) (string, error) {
+	h, err := json.Marshal(header{Alg: alg, Typ: "JWT", Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encode(h) + "." + encode(p)
+	sig, err := sign(alg, key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + encode(sig), nil
+}
+
+func sign(alg string, key interface{}, input []byte) ([]byte, error) {
+	switch alg {
+	case HS256, HS384, HS512:
+		secret, ok := key.([]byte)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		mac := hmac.New(hmacHash(alg), secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case RS256:
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		digest := sha256.Sum256(input)
+		return rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	case EdDSA:
+		priv, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		return ed25519.Sign(priv, input), nil
+	}
+	return nil, ErrUnsupportedAlgorithm
+}
+
+// verify checks sig against input. The key type has to match alg, which
+// rules out algorithm confusion such as an RSA public key used as an HMAC
+// secret.
+func verify(alg string, key interface{}, input, sig []byte) error {
+	switch alg {
+	case HS256, HS384, HS512:
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrInvalidKey
+		}
+		mac := hmac.New(hmacHash(alg), secret)
+		mac.Write(input)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case RS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidKey
+		}
+		digest := sha256.Sum256(input)
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case EdDSA:
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return ErrInvalidKey
+		}
+		if !ed25519.Verify(pub, input, sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	return ErrUnsupportedAlgorithm
+}
+
+func hmacHash(alg string) func() hash.Hash {
+	switch alg {
+	case HS384:
+		return sha512.New384
+	case HS512:
+		return sha512.New
+	}
+	return sha256.New
+}
+
+// decode splits a compact token and decodes its header, claims and
+// signature without verifying anything.
+func decode(token string) (header, Claims, []byte, string, error) {
+	var h header
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return h, nil, nil, "", ErrMalformed
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return h, nil, nil, "", ErrMalformed
+	}
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return h, nil, nil, "", ErrMalformed
+	}
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return h, nil, nil, "", ErrMalformed
+	}
+	var claims Claims
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return h, nil, nil, "", ErrMalformed
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return h, nil, nil, "", ErrMalformed
+	}
+	return h, claims, sig, parts[0] + "." + parts[1], nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
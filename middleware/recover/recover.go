@@ -0,0 +1,53 @@
+package recover
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/abdotop/octopus"
+)
+
+// Config defines the config for the recover middleware.
+type Config struct {
+	// EnableStackTrace adds the stack trace to the response body.
+	// Only turn it on in development.
+	EnableStackTrace bool
+	// PanicHandler receives every recovered panic with its stack, e.g. to
+	// forward it to an error reporter. Panics are logged when it is nil.
+	PanicHandler func(c *octopus.Ctx, r interface{}, stack []byte)
+}
+
+// New returns a middleware that recovers from panics in the handlers after
+// it and turns them into a StatusInternalServerError answered by the App's
+// error handlers.
+func New(config Config) octopus.HandlerFunc {
+	return func(c *octopus.Ctx) (err error) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			// net/http uses this panic to abort a response on purpose
+			if r == http.ErrAbortHandler {
+				panic(r)
+			}
+
+			stack := debug.Stack()
+			if config.PanicHandler != nil {
+				config.PanicHandler(c, r, stack)
+			} else {
+				log.Printf("octopus: panic recovered: %v\n%s", r, stack)
+			}
+
+			if config.EnableStackTrace {
+				err = octopus.NewError(octopus.StatusInternalServerError, fmt.Sprintf("panic: %v\n\n%s", r, stack))
+			} else {
+				err = octopus.NewError(octopus.StatusInternalServerError)
+			}
+		}()
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,52 @@
+package recover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abdotop/octopus"
+)
+
+func TestRecover(t *testing.T) {
+	var reported interface{}
+	app := octopus.New()
+	app.Use(New(Config{
+		PanicHandler: func(c *octopus.Ctx, r interface{}, stack []byte) { reported = r },
+	}))
+	app.OnErrorCode(octopus.StatusInternalServerError, func(c *octopus.Ctx) error {
+		return c.WriteString("something went wrong")
+	})
+	app.Get("/panic", func(c *octopus.Ctx) error { panic("boom") })
+
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, httptest.NewRequest("GET", "/panic", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+	if rr.Body.String() != "something went wrong" {
+		t.Errorf("got body %q", rr.Body.String())
+	}
+	if reported != "boom" {
+		t.Errorf("PanicHandler got %v, want boom", reported)
+	}
+}
+
+func TestRecoverStackTrace(t *testing.T) {
+	app := octopus.New()
+	app.Use(New(Config{
+		EnableStackTrace: true,
+		PanicHandler:     func(c *octopus.Ctx, r interface{}, stack []byte) {},
+	}))
+	app.Get("/panic", func(c *octopus.Ctx) error { panic("boom") })
+
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, httptest.NewRequest("GET", "/panic", nil))
+
+	body := rr.Body.String()
+	if !strings.HasPrefix(body, "panic: boom") || !strings.Contains(body, "goroutine") {
+		t.Errorf("expected the stack trace in the body, got %q", body)
+	}
+}
@@ -0,0 +1,96 @@
+package octopus
+
+import (
+	"strings"
+)
+
+type segmentKind uint8
+
+const (
+	staticSegment segmentKind = iota
+	paramSegment
+	catchAllSegment
+)
+
+// segment is one piece of a route pattern: literal text, a named
+// parameter (":id") or a catch-all ("*" or "*path").
+type segment struct {
+	kind  segmentKind
+	value string // literal text or parameter name
+}
+
+type param struct {
+	key   string
+	value string
+}
+
+// expandPattern returns every concrete pattern described by path. Each
+// optional parameter (":id?") yields one variant with the parameter and one
+// without it, so "/users/:id?" expands to "/users/:id" and "/users". The
+// optional parameters directly following a dropped one are dropped with it:
+// "/:a?/:b?" expands to "/:a/:b", "/:a" and "/", never to "/:b".
+func expandPattern(path string) []string {
+	i := strings.Index(path, "?")
+	if i < 0 {
+		return []string{path}
+	}
+	start := strings.LastIndexByte(path[:i], ':')
+	if start < 0 {
+		return []string{path}
+	}
+
+	with := path[:i] + path[i+1:]
+	without := path[i+1:]
+	for strings.HasPrefix(without, "/:") {
+		end := strings.IndexByte(without[1:], '/') + 1
+		if end == 0 {
+			end = len(without)
+		}
+		if without[end-1] != '?' {
+			break
+		}
+		without = without[end:]
+	}
+	if start > 0 && path[start-1] == '/' {
+		without = path[:start-1] + without
+	} else {
+		without = path[:start] + without
+	}
+	if without == "" {
+		without = "/"
+	}
+
+	return append(expandPattern(with), expandPattern(without)...)
+}
+
+// parsePattern splits a concrete pattern into segments. A parameter runs
+// until the next "/", a catch-all consumes the rest of the pattern.
+func parsePattern(path string) []segment {
+	var segs []segment
+	for len(path) > 0 {
+		switch path[0] {
+		case ':':
+			end := strings.IndexByte(path, '/')
+			if end < 0 {
+				end = len(path)
+			}
+			segs = append(segs, segment{kind: paramSegment, value: path[1:end]})
+			path = path[end:]
+		case '*':
+			name := path[1:]
+			if name == "" {
+				name = "*"
+			}
+			segs = append(segs, segment{kind: catchAllSegment, value: name})
+			path = ""
+		default:
+			end := strings.IndexAny(path, ":*")
+			if end < 0 {
+				end = len(path)
+			}
+			segs = append(segs, segment{kind: staticSegment, value: path[:end]})
+			path = path[end:]
+		}
+	}
+	return segs
+}
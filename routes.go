@@ -1,12 +1,19 @@
 package octopus
 
 import (
+	"net/http"
+	"slices"
+	"strings"
 	"sync"
 )
 
+// routes is a radix tree of registered patterns. Lookups cost O(len(path))
+// regardless of how many routes exist, and when several patterns match the
+// same path the most specific wins: static text beats a parameter, which
+// beats a catch-all.
 type routes struct {
 	sync.RWMutex
-	data map[string]*route
+	root *node
 }
 
 type route struct {
@@ -15,40 +22,67 @@ type route struct {
 	a                *App
 	globalMiddleware []HandlerFunc
 	path             string
+	segments         []segment
+	params           []string
+	allow            string // value of the Allow header
 }
 
 func (rs *routes) add(path string, method string, handler ...HandlerFunc) {
 	rs.Lock()
 	defer rs.Unlock()
-	if rs.data == nil {
-		rs.data = make(map[string]*route)
+	if rs.root == nil {
+		rs.root = &node{kind: staticNode}
 	}
-	if rs.data[path] == nil {
-		rs.data[path] = &route{data: make(map[string][]HandlerFunc)}
+	for _, p := range expandPattern(path) {
+		segs := parsePattern(p)
+		n := rs.root.insert(p)
+		if n.route == nil {
+			n.route = &route{data: make(map[string][]HandlerFunc), path: p, segments: segs, params: paramNames(segs)}
+		} else if names := paramNames(segs); !sameNames(n.route.params, names) {
+			panic(conflictError(p, n.route.path))
+		}
+		n.route.set(method, handler)
 	}
-	rs.data[path].data[method] = handler
 }
 
-func (rs *routes) get(path string, method string) []HandlerFunc {
-	rs.RLock()
-	defer rs.RUnlock()
-	if rs.data == nil {
-		return nil
+func (r *route) set(method string, handlers []HandlerFunc) {
+	r.Lock()
+	defer r.Unlock()
+	r.data[method] = handlers
+	r.allow = allowHeader(r.data)
+}
+
+// allowHeader lists the methods answered on a path, including HEAD when GET
+// is registered and OPTIONS, which always has a default responder.
+func allowHeader(data map[string][]HandlerFunc) string {
+	methods := []string{http.MethodOptions}
+	for m := range data {
+		methods = append(methods, m)
 	}
-	if rs.data[path].data == nil {
-		return nil
+	if _, ok := data[http.MethodGet]; ok {
+		methods = append(methods, http.MethodHead)
 	}
-	return rs.data[path].data[method]
+	slices.Sort(methods)
+	return strings.Join(slices.Compact(methods), ", ")
 }
 
-func (rs *routes) rrange(f func(key string, value *route) bool) {
+// match returns the route whose pattern matches path along with the
+// parameters it captured, appended to ps, or nil when no route matches.
+func (rs *routes) match(path string, ps []param) (*route, []param) {
 	rs.RLock()
 	defer rs.RUnlock()
-	for k, v := range rs.data {
-		if !f(k, v) {
-			break
-		}
+	if rs.root == nil {
+		return nil, ps
 	}
+	mark := len(ps)
+	r, ps := rs.root.lookup(path, ps)
+	if r == nil {
+		return nil, ps[:mark]
+	}
+	for i := range ps[mark:] {
+		ps[mark+i].key = r.params[i]
+	}
+	return r, ps
 }
 
 func (r *route) methodExists(method string) ([]HandlerFunc, bool) {
@@ -58,47 +92,53 @@ func (r *route) methodExists(method string) ([]HandlerFunc, bool) {
 	return hs, exists
 }
 
-func (r *route) Get(path string, handlers ...HandlerFunc) {
+func (r *route) allowed() string {
+	r.RLock()
+	defer r.RUnlock()
+	return r.allow
+}
+
+func (r *route) Get(path string, handlers ...HandlerFunc) *registration {
 	handlers = append(r.globalMiddleware, handlers...)
-	r.a.Get(r.path+path, handlers...)
+	return r.a.Get(r.path+path, handlers...)
 }
 
-func (r *route) DELETE(path string, handlers ...HandlerFunc) {
+func (r *route) DELETE(path string, handlers ...HandlerFunc) *registration {
 	handlers = append(r.globalMiddleware, handlers...)
-	r.a.Post(r.path+path, handlers...)
+	return r.a.DELETE(r.path+path, handlers...)
 }
 
-func (r *route) PUT(path string, handlers ...HandlerFunc) {
+func (r *route) PUT(path string, handlers ...HandlerFunc) *registration {
 	handlers = append(r.globalMiddleware, handlers...)
-	r.a.PUT(r.path+path, handlers...)
+	return r.a.PUT(r.path+path, handlers...)
 }
 
-func (r *route) Post(path string, handlers ...HandlerFunc) {
+func (r *route) Post(path string, handlers ...HandlerFunc) *registration {
 	handlers = append(r.globalMiddleware, handlers...)
-	r.a.Post(r.path+path, handlers...)
+	return r.a.Post(r.path+path, handlers...)
 }
 
-func (r *route) PATCH(path string, handlers ...HandlerFunc) {
+func (r *route) PATCH(path string, handlers ...HandlerFunc) *registration {
 	handlers = append(r.globalMiddleware, handlers...)
-	r.a.PATCH(r.path+path, handlers...)
+	return r.a.PATCH(r.path+path, handlers...)
 }
 
-func (r *route) OPTIONS(path string, handlers ...HandlerFunc) {
+func (r *route) OPTIONS(path string, handlers ...HandlerFunc) *registration {
 	handlers = append(r.globalMiddleware, handlers...)
-	r.a.OPTIONS(r.path+path, handlers...)
+	return r.a.OPTIONS(r.path+path, handlers...)
 }
 
-func (r *route) HEAD(path string, handlers ...HandlerFunc) {
+func (r *route) HEAD(path string, handlers ...HandlerFunc) *registration {
 	handlers = append(r.globalMiddleware, handlers...)
-	r.a.HEAD(r.path+path, handlers...)
+	return r.a.HEAD(r.path+path, handlers...)
 }
 
-func (r *route) Any(path string, handlers ...HandlerFunc) {
+func (r *route) Any(path string, handlers ...HandlerFunc) *registration {
 	handlers = append(r.globalMiddleware, handlers...)
-	r.a.Any(r.path+path, handlers...)
+	return r.a.Any(r.path+path, handlers...)
 }
 
-func (r *route) Method(method string, path string, handlers ...HandlerFunc) {
+func (r *route) Method(method string, path string, handlers ...HandlerFunc) *registration {
 	handlers = append(r.globalMiddleware, handlers...)
-	r.a.Method(method, r.path+path, handlers...)
+	return r.a.Method(method, r.path+path, handlers...)
 }
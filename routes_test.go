@@ -0,0 +1,272 @@
+package octopus
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouteParams(t *testing.T) {
+	app := New()
+	echo := func(c *Ctx) error {
+		params := c.Params()
+		return c.WriteString(params["id"] + "|" + params["path"] + "|" + params["*"])
+	}
+	app.Get("/users/:id", echo)
+	app.Get("/posts/:id?", echo)
+	app.Get("/span/:id?/:path?", echo)
+	app.Get("/files/*path", echo)
+	app.Get("/assets/*", echo)
+	api := app.Group("/api")
+	api.Get("/users/:id", echo)
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/users/42", http.StatusOK, "42||"},
+		{"/users/", http.StatusNotFound, "Not Found"},
+		{"/users/42/extra", http.StatusNotFound, "Not Found"},
+		{"/posts/7", http.StatusOK, "7||"},
+		{"/posts", http.StatusOK, "||"},
+		{"/span/1/2", http.StatusOK, "1|2|"},
+		{"/span/1", http.StatusOK, "1||"},
+		{"/span", http.StatusOK, "||"},
+		{"/files/a/b/c.txt", http.StatusOK, "|a/b/c.txt|"},
+		{"/files/", http.StatusOK, "||"},
+		{"/assets/css/site.css", http.StatusOK, "||css/site.css"},
+		{"/api/users/9", http.StatusOK, "9||"},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+		if rr.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.path, rr.Code, tt.status)
+		}
+		if rr.Body.String() != tt.body {
+			t.Errorf("%s: got body %q, want %q", tt.path, rr.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestParam(t *testing.T) {
+	app := New()
+	var got string
+	app.Get("/orgs/:org/repos/:repo", func(c *Ctx) error {
+		got = c.Param("org") + "/" + c.Param("repo") + c.Param("missing")
+		return nil
+	})
+
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/orgs/abdotop/repos/octopus", nil))
+	if got != "abdotop/octopus" {
+		t.Errorf("got %q, want %q", got, "abdotop/octopus")
+	}
+}
+
+func TestExpandPattern(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/:lang?/docs/:page?", []string{"/:lang/docs/:page", "/:lang/docs", "/docs/:page", "/docs"}},
+		// A later optional only appears when the earlier ones are filled
+		{"/opt/:a?/:b?/:c?", []string{"/opt/:a/:b/:c", "/opt/:a/:b", "/opt/:a", "/opt"}},
+		{"/:a?/:b?/x", []string{"/:a/:b/x", "/:a/x", "/x"}},
+	}
+	for _, tt := range tests {
+		got := expandPattern(tt.path)
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("expandPattern(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRoutePriority(t *testing.T) {
+	app := New()
+	reply := func(s string) HandlerFunc {
+		return func(c *Ctx) error { return c.WriteString(s) }
+	}
+	app.Get("/api/*", reply("catch-all"))
+	app.Get("/api/users", reply("static"))
+	app.Get("/api/:resource", reply("param"))
+	app.Get("/api/users/:id/posts", reply("posts"))
+	app.Get("/api/users/me", reply("me"))
+
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/api/users", "static"},
+		{"/api/orders", "param"},
+		{"/api/users/me", "me"},
+		{"/api/users/7/posts", "posts"},
+		{"/api/users/7", "catch-all"},
+		{"/api/", "catch-all"},
+	}
+
+	// The tree must pick the same winner on every request.
+	for i := 0; i < 20; i++ {
+		for _, tt := range tests {
+			rr := httptest.NewRecorder()
+			app.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if rr.Body.String() != tt.body {
+				t.Fatalf("%s: got %q, want %q", tt.path, rr.Body.String(), tt.body)
+			}
+		}
+	}
+}
+
+func TestRouteConflict(t *testing.T) {
+	app := New()
+	app.Get("/users/:id", func(c *Ctx) error { return nil })
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for conflicting parameter names")
+		}
+	}()
+	app.Post("/users/:name", func(c *Ctx) error { return nil })
+}
+
+func TestMethodHandling(t *testing.T) {
+	app := New()
+	app.Use(func(c *Ctx) error {
+		c.Response().Header().Set("X-Global", "1")
+		return c.Next()
+	})
+	app.Get("/items", func(c *Ctx) error {
+		c.Response().Header().Set("X-Items", "3")
+		return c.WriteString("items")
+	})
+	app.Post("/items", func(c *Ctx) error { return c.WriteString("created") })
+	app.OPTIONS("/custom", func(c *Ctx) error { return c.WriteString("custom options") })
+	app.Get("/custom", func(c *Ctx) error { return nil })
+	api := app.Group("/api")
+	api.DELETE("/items", func(c *Ctx) error { return c.WriteString("deleted") })
+	// Streaming handlers flush through ResponseController, for HEAD too
+	app.Get("/stream", func(c *Ctx) error {
+		if err := c.WriteString("data"); err != nil {
+			return err
+		}
+		return http.NewResponseController(c.Response()).Flush()
+	})
+
+	tests := []struct {
+		method, path string
+		status       int
+		body         string
+		header       map[string]string
+	}{
+		{"PUT", "/items", http.StatusMethodNotAllowed, "", map[string]string{"Allow": "GET, HEAD, OPTIONS, POST"}},
+		{"HEAD", "/items", http.StatusOK, "", map[string]string{"X-Items": "3", "Allow": ""}},
+		{"OPTIONS", "/items", http.StatusNoContent, "", map[string]string{"Allow": "GET, HEAD, OPTIONS, POST", "X-Global": "1"}},
+		{"OPTIONS", "/custom", http.StatusOK, "custom options", map[string]string{"Allow": ""}},
+		{"DELETE", "/api/items", http.StatusOK, "deleted", nil},
+		{"POST", "/api/items", http.StatusMethodNotAllowed, "", map[string]string{"Allow": "DELETE, OPTIONS"}},
+		{"HEAD", "/api/items", http.StatusMethodNotAllowed, "", nil},
+		{"GET", "/stream", http.StatusOK, "data", nil},
+		{"HEAD", "/stream", http.StatusOK, "", nil},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+		if rr.Code != tt.status || rr.Body.String() != tt.body {
+			t.Errorf("%s %s: got %d %q, want %d %q", tt.method, tt.path, rr.Code, rr.Body, tt.status, tt.body)
+		}
+		for name, want := range tt.header {
+			if got := rr.Header().Get(name); got != want {
+				t.Errorf("%s %s: %s = %q, want %q", tt.method, tt.path, name, got, want)
+			}
+		}
+	}
+}
+
+// linearRoutes is the map scan the router used before the radix tree; it is
+// kept here as the baseline for the lookup benchmarks.
+type linearRoutes map[string][]segment
+
+func (lr linearRoutes) match(path string) bool {
+	for _, segs := range lr {
+		if _, ok := matchSegments(segs, path, nil); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func benchmarkPatterns(n int) []string {
+	patterns := make([]string, 0, n)
+	for i := 0; len(patterns) < n; i++ {
+		patterns = append(patterns,
+			fmt.Sprintf("/v%d/users/:id", i),
+			fmt.Sprintf("/v%d/users/:id/posts/:post", i),
+			fmt.Sprintf("/v%d/static/*path", i),
+			fmt.Sprintf("/v%d/health", i),
+		)
+	}
+	return patterns
+}
+
+const benchmarkRouteCount = 4000
+
+var benchmarkPaths = []string{"/v0/health", "/v500/users/42", "/v999/users/42/posts/7", "/v999/static/css/app.css"}
+
+func BenchmarkRadixLookup(b *testing.B) {
+	rs := new(routes)
+	for _, p := range benchmarkPatterns(benchmarkRouteCount) {
+		rs.add(p, "GET")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if r, _ := rs.match(benchmarkPaths[i%len(benchmarkPaths)], nil); r == nil {
+			b.Fatal("no match")
+		}
+	}
+}
+
+func BenchmarkLinearLookup(b *testing.B) {
+	lr := make(linearRoutes)
+	for _, p := range benchmarkPatterns(benchmarkRouteCount) {
+		lr[p] = parsePattern(p)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !lr.match(benchmarkPaths[i%len(benchmarkPaths)]) {
+			b.Fatal("no match")
+		}
+	}
+}
+
+// matchSegments reports whether path satisfies segs and appends the
+// captured parameters to ps.
+func matchSegments(segs []segment, path string, ps []param) ([]param, bool) {
+	for i, s := range segs {
+		switch s.kind {
+		case staticSegment:
+			if !strings.HasPrefix(path, s.value) {
+				return ps, false
+			}
+			path = path[len(s.value):]
+		case paramSegment:
+			end := strings.IndexByte(path, '/')
+			if end < 0 {
+				end = len(path)
+			}
+			if end == 0 {
+				return ps, false
+			}
+			ps = append(ps, param{key: s.value, value: path[:end]})
+			path = path[end:]
+		case catchAllSegment:
+			if i != len(segs)-1 {
+				return ps, false
+			}
+			ps = append(ps, param{key: s.value, value: path})
+			path = ""
+		}
+	}
+	return ps, path == ""
+}
@@ -0,0 +1,143 @@
+package session
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore keeps one file per session in a directory. Each file holds the
+// expiry as big-endian Unix nanoseconds followed by the session data.
+type FileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileStore returns a FileStore writing to dir, creating it if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (f *FileStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return "", fmt.Errorf("session: invalid id %q", id)
+	}
+	return filepath.Join(f.dir, id+".session"), nil
+}
+
+func (f *FileStore) Get(id string) ([]byte, time.Time, error) {
+	p, err := f.path(id)
+	if err != nil {
+		return nil, time.Time{}, ErrNotFound
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return readSessionFile(p)
+}
+
+func (f *FileStore) Set(id string, data []byte, expires time.Time) error {
+	p, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return writeSessionFile(p, data, expires)
+}
+
+func (f *FileStore) Delete(id string) error {
+	p, err := f.path(id)
+	if err != nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (f *FileStore) Touch(id string, expires time.Time) error {
+	p, err := f.path(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, _, err := readSessionFile(p)
+	if err != nil {
+		return err
+	}
+	return writeSessionFile(p, data, expires)
+}
+
+func (f *FileStore) GC(now time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	paths, err := filepath.Glob(filepath.Join(f.dir, "*.session"))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, p := range paths {
+		_, expires, err := readSessionFile(p)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err == nil && now.Before(expires) {
+			continue
+		}
+		if os.Remove(p) == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func readSessionFile(p string) ([]byte, time.Time, error) {
+	b, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if len(b) < 8 {
+		return nil, time.Time{}, ErrNotFound
+	}
+	expires := time.Unix(0, int64(binary.BigEndian.Uint64(b[:8])))
+	return b[8:], expires, nil
+}
+
+// writeSessionFile replaces p atomically so readers never see a partial
+// session.
+func writeSessionFile(p string, data []byte, expires time.Time) error {
+	b := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(b[:8], uint64(expires.UnixNano()))
+	copy(b[8:], data)
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
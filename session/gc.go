@@ -0,0 +1,124 @@
+package session
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/abdotop/octopus"
+)
+
+// GCStats reports the activity of the garbage collector of a session
+// manager.
+type GCStats struct {
+	Runs    int64     // collections run so far
+	Reaped  int64     // sessions removed so far
+	Errors  int64     // collections that failed
+	LastRun time.Time // end of the last collection
+}
+
+// gcWorker is the single goroutine removing expired sessions for a session
+// manager.
+type gcWorker struct {
+	mu      sync.Mutex
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+
+	runs    atomic.Int64
+	reaped  atomic.Int64
+	errors  atomic.Int64
+	lastRun atomic.Int64
+}
+
+// StartGC starts the garbage collector if it is not running. Start does it
+// on first use, so calling it is only needed after StopGC.
+func (s *session) StartGC() {
+	s.gc.mu.Lock()
+	defer s.gc.mu.Unlock()
+	s.gc.started = true
+	if s.gc.stop != nil {
+		return
+	}
+	s.gc.stop = make(chan struct{})
+	s.gc.done = make(chan struct{})
+	go s.gcLoop(s.Config.GCInterval, s.gc.stop, s.gc.done)
+}
+
+// StopGC stops the garbage collector and waits for the collection in
+// progress, if any, to finish.
+func (s *session) StopGC() {
+	s.gc.mu.Lock()
+	stop, done := s.gc.stop, s.gc.done
+	s.gc.stop, s.gc.done = nil, nil
+	s.gc.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// Attach ties the garbage collector to app: it starts now and stops when
+// app shuts down.
+func (s *session) Attach(app *octopus.App) {
+	s.StartGC()
+	app.OnShutdown(s.StopGC)
+}
+
+// startGCOnce starts the garbage collector the first time a session is
+// started, attached to the App serving the request.
+func (s *session) startGCOnce(c *octopus.Ctx) {
+	s.gc.mu.Lock()
+	started := s.gc.started
+	s.gc.mu.Unlock()
+	if started {
+		return
+	}
+	if app := c.App(); app != nil {
+		s.Attach(app)
+		return
+	}
+	s.StartGC()
+}
+
+// GCStats returns the garbage collector counters.
+func (s *session) GCStats() GCStats {
+	stats := GCStats{
+		Runs:   s.gc.runs.Load(),
+		Reaped: s.gc.reaped.Load(),
+		Errors: s.gc.errors.Load(),
+	}
+	if last := s.gc.lastRun.Load(); last != 0 {
+		stats.LastRun = time.Unix(0, last)
+	}
+	return stats
+}
+
+func (s *session) gcLoop(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.collect()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// collect removes the expired sessions once.
+func (s *session) collect() {
+	n, err := s.getStore().GC(time.Now())
+	s.gc.runs.Add(1)
+	s.gc.reaped.Add(int64(n))
+	if err != nil {
+		s.gc.errors.Add(1)
+	}
+	s.gc.lastRun.Store(time.Now().UnixNano())
+	if s.Config.OnGC != nil {
+		s.Config.OnGC(n, err)
+	}
+}
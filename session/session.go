@@ -1,7 +1,9 @@
 package session
 
 import (
+	"bytes"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,8 +17,6 @@ import (
 	"github.com/gofrs/uuid"
 )
 
-var Notif sync.Map
-
 type Config struct {
 	CookieName string
 	Value      string
@@ -35,24 +35,24 @@ type Config struct {
 	SameSite http.SameSite
 	Raw      string
 	Unparsed []string // Max-Age attribute present and given in seconds
-}
 
-type starter struct {
-	session *session
-	Ctx     *octopus.Ctx
+	// Codec encodes the session values for the Store. Defaults to JSON.
+	Codec Codec
+
+	// GCInterval is how often expired sessions are removed from the Store.
+	// Defaults to 10 seconds.
+	GCInterval time.Duration
+	// OnGC, when set, is called after every collection with the number of
+	// sessions removed and the Store error, if any.
+	OnGC func(reaped int, err error)
 }
 
 type session struct {
 	Config      *Config
-	database    *sql.DB
-	data        *sync.Map
+	store       Store
 	mu          sync.Mutex
 	SessionName string
-}
-
-type storage struct {
-	cookie *http.Cookie
-	id     uuid.UUID
+	gc          gcWorker
 }
 
 func New(c *Config) *session {
@@ -72,322 +72,285 @@ func New(c *Config) *session {
 	if c.SameSite == sS {
 		c.SameSite = http.SameSiteNoneMode
 	}
-	s := &session{Config: c, SessionName: c.CookieName, database: nil, data: &sync.Map{}}
+	if c.Codec == nil {
+		c.Codec = JSON
+	}
+	if c.GCInterval <= 0 {
+		c.GCInterval = 10 * time.Second
+	}
+	s := &session{Config: c, SessionName: c.CookieName, store: NewMemoryStore()}
 	return s
 }
 
-func (s *session) tmp() {
-	go func() {
-		ticker := time.NewTicker(10 * time.Second)
-		quit := make(chan struct{})
-		go func() {
-			for {
-				select {
-				case <-ticker.C:
-					s.mu.Lock()
-					if s.database != nil {
-						_, err := s.database.Exec(fmt.Sprintf(`DELETE FROM %s WHERE datetime(expiration_date) <= datetime('now')`, s.SessionName))
-						if err != nil {
-							fmt.Println(err)
-							s.mu.Unlock()
-							return
-						}
-					}
-					s.data.Range(func(key, value any) bool {
-						val, ok := value.(map[string]interface{})
-						userKey := val["key"].(uuid.UUID)
-						Storage := val["cookie"].(*storage)
-						if ok {
-							expirationDate := Storage.cookie.Expires
-							// Vérifiez si la session a expiré
-							if time.Now().After(expirationDate) {
-								s.data.Delete(key)
-								Notif.Store(userKey, false)
-								return true
-							}
-							//  else {
-							// 	Notif.Store(userKey, true)
-							// 	return true
-							// }
-						}
-						return true
-					})
-					s.mu.Unlock()
-
-				case <-quit:
-					ticker.Stop()
-					return
-				}
-			}
-		}()
-
-		// Attendez que l'Application se termine.
-		time.Sleep(30 * time.Minute)
-		close(quit)
-	}()
+// UseStore replaces the storage backing the sessions, the in-memory
+// MemoryStore by default.
+func (s *session) UseStore(store Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store = store
 }
 
+// UseDB stores the sessions in db, in a table named after the cookie with a
+// "_sessions" suffix, using the SQLite dialect. Use UseStore with
+// NewSQLStore for other databases.
 func (s *session) UseDB(db *sql.DB) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.database = db
-	_, err := s.database.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (id UUID PRIMARY KEY,user_id UUID NOT NULL,expiration_date DATETIME NOT NULL);`, s.SessionName))
+	store, err := NewSQLStore(db, s.SessionName+"_sessions", SQLite)
 	if err != nil {
 		log.Fatal(err)
 	}
+	s.UseStore(store)
 }
 
-func (s *session) Start(c *octopus.Ctx) *starter {
-	s.tmp()
-	return &starter{session: s, Ctx: c}
+func (s *session) getStore() Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store
 }
 
-func (s *starter) Set(value uuid.UUID) error {
-	s.session.mu.Lock()
-	defer s.session.mu.Unlock()
+// Start returns the session of the request, or a new empty one when the
+// request has no valid session cookie.
+func (s *session) Start(c *octopus.Ctx) (*Session, error) {
+	s.startGCOnce(c)
+	sess := &Session{manager: s, ctx: c}
 
-	session := s.session
-	c := session.Config
-	db := session.database
-	tmpdata := session.data
-	// get new id for the session
-	id, err := uuid.NewV4()
+	r := c.Request()
+	if r == nil {
+		return nil, fmt.Errorf("erreur lors de la récupération de la requête")
+	}
+	cookie, err := r.Cookie(s.Config.CookieName)
 	if err != nil {
-		return err
+		return sess.init()
 	}
-	if db != nil {
-		var user uuid.UUID
-		err = db.QueryRow(fmt.Sprintf("SELECT id FROM %s WHERE user_id = $1", session.SessionName), value).Scan(&user)
-		if err != sql.ErrNoRows {
-
-			// // Préparez une instruction SQL pour supprimer la session
-			stmt, err := db.Prepare(fmt.Sprintf("DELETE FROM %s WHERE id=$1", session.SessionName))
-			if err != nil {
-				return err
-			}
-
-			// // Exécutez l'instruction SQL avec l'UUID de la session
-			_, err = stmt.Exec(user)
-			if err != nil {
-				return err
-			}
-			tmpdata.Delete(user.String())
-		}
-		// fmt.Println(user)
-		stmt, err := db.Prepare(fmt.Sprintf("INSERT INTO %s (id, user_id, expiration_date) VALUES($1, $2, $3)", session.SessionName))
-		if err != nil {
-			return err
-		}
-		// Exécutez l'instruction SQL avec le nouvel UUID et les autres valeurs
-		_, err = stmt.Exec(id, value, time.Now().Add(time.Second*time.Duration(c.MaxAge)))
-		if err != nil {
-			return err
-		}
 
+	store := s.getStore()
+	data, expires, err := store.Get(cookie.Value)
+	if errors.Is(err, ErrNotFound) {
+		return sess.init()
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Vérifiez si la session a expiré
+	if !time.Now().Before(expires) {
+		store.Delete(cookie.Value)
+		return sess.init()
 	}
-	// Stockez la session dans un cookie
-	cookie := &http.Cookie{
+
+	values := make(map[string][]byte)
+	if err := s.Config.Codec.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("erreur lors du décodage de la session : %v", err)
+	}
+	sess.id = cookie.Value
+	sess.values = values
+	sess.expires = expires
+	return sess, nil
+}
+
+func (s *session) cookie(value string, expires time.Time, maxAge int) *http.Cookie {
+	c := s.Config
+	return &http.Cookie{
 		Name:     c.CookieName,
-		Value:    id.String(),
+		Value:    value,
 		Secure:   c.Secure,
-		Expires:  time.Now().Add(time.Second * time.Duration(c.MaxAge)),
-		MaxAge:   c.MaxAge,
+		Expires:  expires,
+		MaxAge:   maxAge,
 		Path:     c.Path,
 		Domain:   c.Domain,
 		HttpOnly: c.HttpOnly,
 		SameSite: c.SameSite,
 	}
+}
+
+// Session holds the values of one visitor. Values are encoded with the
+// configured Codec when set, and the session is only written back to the
+// Store by Save when one of them changed.
+type Session struct {
+	mu          sync.Mutex
+	manager     *session
+	ctx         *octopus.Ctx
+	id          string
+	values      map[string][]byte
+	expires     time.Time
+	isNew       bool
+	dirty       bool
+	cookieSent  bool
+	previousIDs []string
+}
 
-	w, wok := s.Ctx.Values.Get("response")
-	if wok {
-		w := w.(http.ResponseWriter)
-		http.SetCookie(w, cookie)
-		tmpdata.Store(id.String(), map[string]interface{}{
-			"key":    value,
-			"cookie": &storage{cookie: cookie, id: value},
-		})
+func (s *Session) init() (*Session, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
 	}
-	Notif.Store(value, true)
-	return nil
+	s.id = id.String()
+	s.values = make(map[string][]byte)
+	s.expires = time.Now().Add(time.Second * time.Duration(s.manager.Config.MaxAge))
+	s.isNew = true
+	return s, nil
 }
 
-func (s *starter) Get() (uuid.UUID, error) {
-	s.session.mu.Lock()
-	defer s.session.mu.Unlock()
+// ID returns the session id stored in the cookie.
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
 
-	session := s.session
-	c := session.Config
-	db := session.database
-	tmpdata := session.data
+// IsNew reports whether the session was created by this request.
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isNew
+}
 
-	r, rok := s.Ctx.Values.Get("request")
-	if !rok {
-		return uuid.Nil, fmt.Errorf("erreur lors de la récupération de la requête")
+// Get decodes the value stored under key into out, which must be a pointer.
+func (s *Session) Get(key string, out interface{}) error {
+	s.mu.Lock()
+	data, ok := s.values[key]
+	s.mu.Unlock()
+	if !ok {
+		return ErrKeyNotFound
 	}
+	return s.manager.Config.Codec.Unmarshal(data, out)
+}
 
-	rr := r.(*http.Request)
-	// Récupérez le cookie
-	cookie, err := rr.Cookie(c.CookieName)
+// Has reports whether a value is stored under key.
+func (s *Session) Has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.values[key]
+	return ok
+}
+
+// Set stores value under key. The session cookie is sent with the first
+// change of a new session, so call Set before writing the response body.
+func (s *Session) Set(key string, value interface{}) error {
+	data, err := s.manager.Config.Codec.Marshal(value)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("erreur lors de la récupération du cookie : %v", err)
-	}
-	// Récupérez l'ID de session à partir du cookie
-	sessionID := cookie.Value
-	value, ok := tmpdata.Load(sessionID)
-	if ok {
-		val, ok := value.(map[string]interface{})
-		userKey := val["key"].(uuid.UUID)
-		Storage := val["cookie"].(*storage)
-		if ok {
-			expirationDate := Storage.cookie.Expires
-			if time.Now().After(expirationDate) {
-				tmpdata.Delete(sessionID)
-				Notif.Store(userKey, false)
-				return uuid.Nil, fmt.Errorf("la session a expiré")
-			} else {
-				Notif.Store(userKey, true)
-				return Storage.id, nil
-			}
-		}
+		return err
 	}
-	if db != nil {
-		// Récupérez la session de la base de données
-		var userID uuid.UUID
-		var expirationDate time.Time
-		err = db.QueryRow(fmt.Sprintf("SELECT user_id, expiration_date FROM %s WHERE id = $1", session.SessionName), sessionID).Scan(&userID, &expirationDate)
-		if err != nil {
-			return uuid.Nil, fmt.Errorf("erreur lors de la récupération de la session : %v", err)
-		}
-
-		// Vérifiez si la session a expiré
-		if time.Now().After(expirationDate) {
-			Notif.Store(userID, false)
-			return uuid.Nil, fmt.Errorf("la session a expiré")
-		}
-		Notif.Store(userID, true)
-		return userID, nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.values[key]; ok && bytes.Equal(old, data) {
+		return nil
 	}
-	// Retournez l'ID de l'utilisateur et nil
-	return uuid.Nil, fmt.Errorf("erreur lors de la récupération du cookie")
+	s.values[key] = data
+	s.markDirty()
+	return nil
 }
 
-func (s *starter) Valid() bool {
-	s.session.mu.Lock()
-	defer s.session.mu.Unlock()
-
-	session := s.session
-	c := session.Config
-	db := session.database
-	tmpdata := session.data
-
-	r, rok := s.Ctx.Values.Get("request")
-	if !rok {
-		return false
+// Delete removes the value stored under key.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.markDirty()
 	}
+}
 
-	rr := r.(*http.Request)
-	cookie, err := rr.Cookie(c.CookieName)
+// Regenerate moves the values to a new session id, which should be done
+// whenever the privilege level changes, e.g. on login.
+func (s *Session) Regenerate() error {
+	id, err := uuid.NewV4()
 	if err != nil {
-		// Le cookie n'existe pas
-		return false
+		return err
 	}
-	value, ok := tmpdata.Load(cookie.Value)
-	if ok {
-		val, ok := value.(map[string]interface{})
-		userKey := val["key"].(uuid.UUID)
-		Storage := val["cookie"].(*storage)
-		if ok {
-			expirationDate := Storage.cookie.Expires
-			if time.Now().After(expirationDate) {
-				tmpdata.Delete(cookie.Value)
-				Notif.Store(userKey, false)
-				return false
-			} else {
-				Notif.Store(userKey, true)
-				return true
-			}
-		}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.isNew {
+		s.previousIDs = append(s.previousIDs, s.id)
 	}
-	if db != nil {
-		// Récupérez la session de la base de données
-		var expirationDate time.Time
-		var userID uuid.UUID
-		err = db.QueryRow(fmt.Sprintf("SELECT user_id, expiration_date FROM %s WHERE id = ?", session.SessionName), cookie.Value).Scan(&userID, &expirationDate)
-		if err != nil {
-			// La session n'existe pas dans la base de données
-			return false
-		}
-
-		// Vérifiez si la session a expiré
-		if time.Now().After(expirationDate) {
-			// La session a expiré
-			Notif.Store(userID, false)
-			return false
-		}
+	s.id = id.String()
+	s.cookieSent = false
+	s.markDirty()
+	return nil
+}
 
-		// Le cookie existe et la session est valide
-		Notif.Store(userID, true)
-		return true
+func (s *Session) markDirty() {
+	s.dirty = true
+	if s.cookieSent {
+		return
+	}
+	if w := s.ctx.Response(); w != nil {
+		http.SetCookie(w, s.manager.cookie(s.id, s.expires, s.manager.Config.MaxAge))
+		s.cookieSent = true
 	}
-	return false
 }
 
-func (s *starter) Delete() error {
-	s.session.mu.Lock()
-	defer s.session.mu.Unlock()
-
-	session := s.session
-	c := session.Config
-	db := session.database
-	tmpdata := session.data
-	Ctx := s.Ctx
-
-	r, rok := Ctx.Values.Get("request")
-	if !rok {
-		return fmt.Errorf("erreur lors de la récupération de la requête")
+// Save writes the session to the Store if it changed since Start.
+func (s *Session) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
 	}
-
-	rr := r.(*http.Request)
-	cookie, err := rr.Cookie(c.CookieName)
+	store := s.manager.getStore()
+	data, err := s.manager.Config.Codec.Marshal(s.values)
 	if err != nil {
-		// Le cookie n'existe pas
 		return err
 	}
-	if db != nil {
-		// Préparez une instruction SQL pour supprimer la session
-		stmt, err := db.Prepare(fmt.Sprintf("DELETE FROM %s WHERE id=$1", session.SessionName))
-		if err != nil {
+	if err := store.Set(s.id, data, s.expires); err != nil {
+		return err
+	}
+	for _, id := range s.previousIDs {
+		if err := store.Delete(id); err != nil {
 			return err
 		}
+	}
+	s.previousIDs = nil
+	s.dirty = false
+	s.isNew = false
+	return nil
+}
 
-		// Exécutez l'instruction SQL avec l'UUID de la session
-		_, err = stmt.Exec(cookie.Value)
-		if err != nil {
+// Destroy removes the session from the Store and expires its cookie.
+func (s *Session) Destroy() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	store := s.manager.getStore()
+	for _, id := range append(s.previousIDs, s.id) {
+		if err := store.Delete(id); err != nil {
 			return err
 		}
 	}
+	s.values = make(map[string][]byte)
+	s.previousIDs = nil
+	s.dirty = false
 
-	value, ok := tmpdata.LoadAndDelete(cookie.Value)
-	if ok {
-		val, ok := value.(map[string]interface{})
-		if ok {
-			userKey := val["key"].(uuid.UUID)
-			Notif.Store(userKey, false)
-		}
+	if w := s.ctx.Response(); w != nil {
+		// Supprimez le cookie de la session
+		http.SetCookie(w, s.manager.cookie("", time.Unix(0, 0), -1))
 	}
+	return nil
+}
 
-	w, wok := s.Ctx.Values.Get("response")
-	if wok {
-		w := w.(http.ResponseWriter)
-		// Supprimez le cookie de la session
-		http.SetCookie(w, &http.Cookie{
-			Name:    c.CookieName,
-			Value:   "",
-			Secure:  c.Secure,
-			Expires: time.Unix(0, 0),
-			MaxAge:  -1,
-		})
+// Value returns the value stored under key decoded as a T.
+func Value[T any](s *Session, key string) (T, error) {
+	var v T
+	err := s.Get(key, &v)
+	return v, err
+}
+
+var sessionKey = octopus.NewKey[*Session]("session")
+
+// Middleware starts the session of every request, makes it available
+// through FromCtx and saves it once the handlers after it have returned.
+func (s *session) Middleware() octopus.HandlerFunc {
+	return func(c *octopus.Ctx) error {
+		sess, err := s.Start(c)
+		if err != nil {
+			return err
+		}
+		octopus.SetLocal(c, sessionKey, sess)
+		if err := c.Next(); err != nil {
+			return err
+		}
+		return sess.Save()
 	}
+}
 
-	return nil
+// FromCtx returns the session started by Middleware.
+func FromCtx(c *octopus.Ctx) (*Session, bool) {
+	return octopus.Locals(c, sessionKey)
 }
@@ -0,0 +1,280 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/abdotop/octopus"
+)
+
+func testStore(t *testing.T, store Store) {
+	// SQLStore keeps expiries to the second
+	now := time.Now().Truncate(time.Second)
+	if _, _, err := store.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get missing: got %v, want ErrNotFound", err)
+	}
+
+	if err := store.Set("a", []byte("alice"), now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("b", []byte("bob"), now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	data, expires, err := store.Get("a")
+	if err != nil || string(data) != "alice" || !expires.Equal(now.Add(time.Hour)) {
+		t.Errorf("Get: got %q %v %v", data, expires, err)
+	}
+
+	if err := store.Touch("missing", now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Touch missing: got %v, want ErrNotFound", err)
+	}
+	later := now.Add(2 * time.Hour)
+	if err := store.Touch("a", later); err != nil {
+		t.Fatal(err)
+	}
+	if _, expires, _ := store.Get("a"); !expires.Equal(later) {
+		t.Errorf("Touch: got expiry %v, want %v", expires, later)
+	}
+
+	n, err := store.GC(now)
+	if err != nil || n != 1 {
+		t.Errorf("GC: got %d, %v, want 1", n, err)
+	}
+	if _, _, err := store.Get("b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired session survived GC: %v", err)
+	}
+
+	if err := store.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("a"); err != nil {
+		t.Errorf("Delete twice: %v", err)
+	}
+	if _, _, err := store.Get("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get deleted: got %v", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+
+	if err := store.Set("../escape", nil, time.Now()); err == nil {
+		t.Error("expected ids with path elements to be rejected")
+	}
+}
+
+func TestSQLDialects(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		touch   string
+		gc      string
+	}{
+		{SQLite, "UPDATE sessions SET expires_at = $1 WHERE id = $2", "DELETE FROM sessions WHERE expires_at <= CAST(strftime('%s', 'now') AS INTEGER)"},
+		{Postgres, "UPDATE sessions SET expires_at = $1 WHERE id = $2", "DELETE FROM sessions WHERE expires_at <= CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT)"},
+		{MySQL, "UPDATE sessions SET expires_at = ? WHERE id = ?", "DELETE FROM sessions WHERE expires_at <= UNIX_TIMESTAMP()"},
+		{Dialect{Placeholder: questionPlaceholder}, "UPDATE sessions SET expires_at = ? WHERE id = ?", "DELETE FROM sessions WHERE expires_at <= ?"},
+	}
+	for _, tt := range tests {
+		q := buildQueries("sessions", tt.dialect)
+		if q.touch != tt.touch {
+			t.Errorf("touch: got %q, want %q", q.touch, tt.touch)
+		}
+		if q.gc != tt.gc {
+			t.Errorf("gc: got %q, want %q", q.gc, tt.gc)
+		}
+	}
+}
+
+// countingStore records how many times sessions are written.
+type countingStore struct {
+	Store
+	sets int
+}
+
+func (c *countingStore) Set(id string, data []byte, expires time.Time) error {
+	c.sets++
+	return c.Store.Set(id, data, expires)
+}
+
+type cart struct {
+	Items []string
+	Total int
+}
+
+func TestSessionValues(t *testing.T) {
+	for name, codec := range map[string]Codec{"json": JSON, "gob": Gob} {
+		t.Run(name, func(t *testing.T) {
+			store := &countingStore{Store: NewMemoryStore()}
+			sessions := New(&Config{CookieName: "sid", Codec: codec})
+			sessions.UseStore(store)
+
+			app := octopus.New()
+			app.Use(sessions.Middleware())
+			app.Get("/add", func(c *octopus.Ctx) error {
+				sess, _ := FromCtx(c)
+				var cur cart
+				sess.Get("cart", &cur)
+				cur.Items = append(cur.Items, c.Query("item"))
+				cur.Total++
+				if err := sess.Set("cart", cur); err != nil {
+					return err
+				}
+				return sess.Set("locale", "fr")
+			})
+			app.Get("/show", func(c *octopus.Ctx) error {
+				sess, _ := FromCtx(c)
+				cur, err := Value[cart](sess, "cart")
+				if err != nil {
+					return err
+				}
+				locale, _ := Value[string](sess, "locale")
+				if _, err := Value[int](sess, "missing"); !errors.Is(err, ErrKeyNotFound) {
+					return err
+				}
+				return c.WriteString(fmt.Sprintf("%v %d %s", cur.Items, cur.Total, locale))
+			})
+			app.Get("/logout", func(c *octopus.Ctx) error {
+				sess, _ := FromCtx(c)
+				return sess.Destroy()
+			})
+
+			rr := httptest.NewRecorder()
+			app.ServeHTTP(rr, httptest.NewRequest("GET", "/add?item=apple", nil))
+			cookies := rr.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("expected one session cookie, got %v", cookies)
+			}
+			request := func(path string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest("GET", path, nil)
+				req.AddCookie(cookies[0])
+				rr := httptest.NewRecorder()
+				app.ServeHTTP(rr, req)
+				return rr
+			}
+
+			request("/add?item=pear")
+			if store.sets != 2 {
+				t.Errorf("got %d writes after two changes, want 2", store.sets)
+			}
+			if rr := request("/show"); rr.Body.String() != "[apple pear] 2 fr" {
+				t.Errorf("show: got %d %q", rr.Code, rr.Body.String())
+			}
+			if store.sets != 2 {
+				t.Errorf("reading the session wrote it back (%d writes)", store.sets)
+			}
+
+			request("/logout")
+			if rr := request("/show"); rr.Code != http.StatusInternalServerError {
+				t.Errorf("show after logout: got %d %q", rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRegenerate(t *testing.T) {
+	store := NewMemoryStore()
+	sessions := New(nil)
+	sessions.UseStore(store)
+	app := octopus.New()
+	app.Use(sessions.Middleware())
+	var ids []string
+	app.Get("/", func(c *octopus.Ctx) error {
+		sess, _ := FromCtx(c)
+		ids = append(ids, sess.ID())
+		if sess.IsNew() {
+			return sess.Set("user", "alice")
+		}
+		return sess.Regenerate()
+	})
+
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(rr.Result().Cookies()[0])
+	rr = httptest.NewRecorder()
+	app.ServeHTTP(rr, req)
+
+	newID := rr.Result().Cookies()[0].Value
+	if newID == ids[0] {
+		t.Fatal("Regenerate kept the session id")
+	}
+	if _, _, err := store.Get(ids[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("old session still stored: %v", err)
+	}
+	if data, _, err := store.Get(newID); err != nil || len(data) == 0 {
+		t.Errorf("new session not stored: %v", err)
+	}
+}
+
+func TestGCGoroutinesStayFlat(t *testing.T) {
+	sessions := New(nil)
+	app := octopus.New()
+	app.Use(sessions.Middleware())
+	app.Get("/", func(c *octopus.Ctx) error { return nil })
+
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	before := runtime.NumGoroutine()
+	for i := 0; i < 2000; i++ {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	if after := runtime.NumGoroutine(); after > before+2 {
+		t.Errorf("goroutines grew from %d to %d", before, after)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	app.Shutdown(ctx)
+	sessions.gc.mu.Lock()
+	running := sessions.gc.stop != nil
+	sessions.gc.mu.Unlock()
+	if running {
+		t.Error("GC worker still running after the App shut down")
+	}
+}
+
+func TestGCReapsExpiredSessions(t *testing.T) {
+	store := NewMemoryStore()
+	reaped := make(chan int, 10)
+	sessions := New(&Config{
+		GCInterval: 10 * time.Millisecond,
+		OnGC: func(n int, err error) {
+			if n > 0 {
+				reaped <- n
+			}
+		},
+	})
+	sessions.UseStore(store)
+	store.Set("old", []byte("{}"), time.Now().Add(-time.Minute))
+	store.Set("fresh", []byte("{}"), time.Now().Add(time.Minute))
+
+	sessions.StartGC()
+	defer sessions.StopGC()
+	select {
+	case n := <-reaped:
+		if n != 1 {
+			t.Errorf("reaped %d sessions, want 1", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("GC did not run")
+	}
+	if stats := sessions.GCStats(); stats.Reaped != 1 || stats.Runs == 0 || stats.LastRun.IsZero() {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if _, _, err := store.Get("fresh"); err != nil {
+		t.Errorf("fresh session was reaped: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package session
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Dialect describes the SQL flavour spoken by the database behind a
+// SQLStore.
+type Dialect struct {
+	// Placeholder returns the bind parameter for the n-th argument,
+	// starting at 1.
+	Placeholder func(n int) string
+	// BlobType is the column type holding session data.
+	BlobType string
+	// UnixNow is an expression giving the current Unix time in seconds.
+	// When set, GC compares expiries with the database clock instead of
+	// the application's.
+	UnixNow string
+}
+
+var (
+	SQLite = Dialect{
+		Placeholder: dollarPlaceholder,
+		BlobType:    "BLOB",
+		UnixNow:     "CAST(strftime('%s', 'now') AS INTEGER)",
+	}
+	Postgres = Dialect{
+		Placeholder: dollarPlaceholder,
+		BlobType:    "BYTEA",
+		UnixNow:     "CAST(EXTRACT(EPOCH FROM NOW()) AS BIGINT)",
+	}
+	MySQL = Dialect{
+		Placeholder: questionPlaceholder,
+		BlobType:    "BLOB",
+		UnixNow:     "UNIX_TIMESTAMP()",
+	}
+)
+
+func dollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func questionPlaceholder(int) string {
+	return "?"
+}
+
+// SQLStore keeps sessions in a database/sql table with the columns id,
+// data and expires_at, the latter holding Unix seconds so that every
+// database compares it the same way.
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+	queries sqlQueries
+}
+
+type sqlQueries struct {
+	create, check, get, insert, delete, touch, gc string
+}
+
+func buildQueries(table string, dialect Dialect) sqlQueries {
+	p := dialect.Placeholder
+	q := sqlQueries{
+		create: fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id VARCHAR(64) PRIMARY KEY, data %s NOT NULL, expires_at BIGINT NOT NULL)", table, dialect.BlobType),
+		check:  fmt.Sprintf("SELECT id, data, expires_at FROM %s WHERE 1 = 0", table),
+		get:    fmt.Sprintf("SELECT data, expires_at FROM %s WHERE id = %s", table, p(1)),
+		insert: fmt.Sprintf("INSERT INTO %s (id, data, expires_at) VALUES (%s, %s, %s)", table, p(1), p(2), p(3)),
+		delete: fmt.Sprintf("DELETE FROM %s WHERE id = %s", table, p(1)),
+		touch:  fmt.Sprintf("UPDATE %s SET expires_at = %s WHERE id = %s", table, p(1), p(2)),
+	}
+	if dialect.UnixNow != "" {
+		q.gc = fmt.Sprintf("DELETE FROM %s WHERE expires_at <= %s", table, dialect.UnixNow)
+	} else {
+		q.gc = fmt.Sprintf("DELETE FROM %s WHERE expires_at <= %s", table, p(1))
+	}
+	return q
+}
+
+// NewSQLStore returns a SQLStore using table, creating it if it does not
+// exist. It fails if table exists with other columns, such as the
+// (id, user_id, expiration_date) table of earlier versions.
+func NewSQLStore(db *sql.DB, table string, dialect Dialect) (*SQLStore, error) {
+	if dialect.Placeholder == nil {
+		dialect.Placeholder = questionPlaceholder
+	}
+	if dialect.BlobType == "" {
+		dialect.BlobType = "BLOB"
+	}
+
+	s := &SQLStore{db: db, dialect: dialect, queries: buildQueries(table, dialect)}
+	if _, err := db.Exec(s.queries.create); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(s.queries.check)
+	if err != nil {
+		return nil, fmt.Errorf("session: table %s lacks the id, data and expires_at columns: %w", table, err)
+	}
+	rows.Close()
+	return s, nil
+}
+
+func (s *SQLStore) Get(id string) ([]byte, time.Time, error) {
+	var (
+		data    []byte
+		expires int64
+	)
+	err := s.db.QueryRow(s.queries.get, id).Scan(&data, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return data, time.Unix(expires, 0), nil
+}
+
+// Set replaces the row inside a transaction, which works on every database
+// without relying on a dialect specific upsert.
+func (s *SQLStore) Set(id string, data []byte, expires time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.queries.delete, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(s.queries.insert, id, data, expires.Unix()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Delete(id string) error {
+	_, err := s.db.Exec(s.queries.delete, id)
+	return err
+}
+
+func (s *SQLStore) Touch(id string, expires time.Time) error {
+	res, err := s.db.Exec(s.queries.touch, expires.Unix(), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// MySQL does not count rows left unchanged
+		_, _, err := s.Get(id)
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) GC(now time.Time) (int, error) {
+	var (
+		res sql.Result
+		err error
+	)
+	if s.dialect.UnixNow != "" {
+		res, err = s.db.Exec(s.queries.gc)
+	} else {
+		res, err = s.db.Exec(s.queries.gc, now.Unix())
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
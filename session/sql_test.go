@@ -0,0 +1,219 @@
+package session
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDriver is a tiny database/sql driver understanding the statements
+// SQLStore issues, so that the Store contract can be tested without a real
+// database.
+type fakeDriver struct {
+	mu     sync.Mutex
+	tables map[string]*fakeTable
+}
+
+type fakeTable struct {
+	columns []string
+	rows    map[string][]driver.Value // id -> data, expires_at
+}
+
+var fakeDBs = struct {
+	sync.Mutex
+	n int
+}{}
+
+func init() {
+	sql.Register("fake", &fakeDriver{tables: make(map[string]*fakeTable)})
+}
+
+// openFakeDB returns a connection to an empty fake database.
+func openFakeDB(t *testing.T) *sql.DB {
+	fakeDBs.Lock()
+	fakeDBs.n++
+	name := fmt.Sprintf("db%d", fakeDBs.n)
+	fakeDBs.Unlock()
+	db, err := sql.Open("fake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{d: d, db: name}, nil
+}
+
+type fakeConn struct {
+	d  *fakeDriver
+	db string
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c: c, query: query}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeConn) Commit() error             { return nil }
+func (c *fakeConn) Rollback() error           { return nil }
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+var (
+	createRe = regexp.MustCompile(`^CREATE TABLE IF NOT EXISTS (\w+) \((.*)\)$`)
+	selectRe = regexp.MustCompile(`^SELECT (.+) FROM (\w+) WHERE (.+)$`)
+	insertRe = regexp.MustCompile(`^INSERT INTO (\w+) \(id, data, expires_at\)`)
+	deleteRe = regexp.MustCompile(`^DELETE FROM (\w+) WHERE (id =|expires_at <=) \?$`)
+	updateRe = regexp.MustCompile(`^UPDATE (\w+) SET expires_at = \? WHERE id = \?$`)
+)
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.c.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if m := createRe.FindStringSubmatch(s.query); m != nil {
+		key := s.c.db + "." + m[1]
+		if d.tables[key] == nil {
+			table := &fakeTable{rows: make(map[string][]driver.Value)}
+			for _, def := range strings.Split(m[2], ",") {
+				table.columns = append(table.columns, strings.Fields(def)[0])
+			}
+			d.tables[key] = table
+		}
+		return driver.RowsAffected(0), nil
+	}
+	if m := insertRe.FindStringSubmatch(s.query); m != nil {
+		table, err := s.table(m[1])
+		if err != nil {
+			return nil, err
+		}
+		table.rows[args[0].(string)] = []driver.Value{args[1], args[2]}
+		return driver.RowsAffected(1), nil
+	}
+	if m := deleteRe.FindStringSubmatch(s.query); m != nil {
+		table, err := s.table(m[1])
+		if err != nil {
+			return nil, err
+		}
+		n := 0
+		for id, row := range table.rows {
+			if (m[2] == "id =" && id == args[0]) || (m[2] != "id =" && row[1].(int64) <= args[0].(int64)) {
+				delete(table.rows, id)
+				n++
+			}
+		}
+		return driver.RowsAffected(n), nil
+	}
+	if m := updateRe.FindStringSubmatch(s.query); m != nil {
+		table, err := s.table(m[1])
+		if err != nil {
+			return nil, err
+		}
+		row, ok := table.rows[args[1].(string)]
+		if !ok {
+			return driver.RowsAffected(0), nil
+		}
+		row[1] = args[0]
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("fake: unsupported statement %q", s.query)
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.c.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	m := selectRe.FindStringSubmatch(s.query)
+	if m == nil {
+		return nil, fmt.Errorf("fake: unsupported query %q", s.query)
+	}
+	table, err := s.table(m[2])
+	if err != nil {
+		return nil, err
+	}
+	columns := strings.Split(m[1], ", ")
+	for _, col := range columns {
+		if !contains(table.columns, col) {
+			return nil, fmt.Errorf("fake: no such column: %s", col)
+		}
+	}
+	rows := &fakeRows{columns: columns}
+	if m[3] == "id = ?" {
+		if row, ok := table.rows[args[0].(string)]; ok {
+			rows.values = [][]driver.Value{row}
+		}
+	}
+	return rows, nil
+}
+
+func (s *fakeStmt) table(name string) (*fakeTable, error) {
+	table := s.c.d.tables[s.c.db+"."+name]
+	if table == nil {
+		return nil, fmt.Errorf("fake: no such table: %s", name)
+	}
+	return table, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSQLStore(t *testing.T) {
+	dialect := Dialect{Placeholder: questionPlaceholder}
+	store, err := NewSQLStore(openFakeDB(t), "sessions", dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
+
+func TestSQLStoreLegacyTable(t *testing.T) {
+	db := openFakeDB(t)
+	// Table created by UseDB before the Store interface existed
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS session (id UUID PRIMARY KEY,user_id UUID NOT NULL,expiration_date DATETIME NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSQLStore(db, "session", Dialect{Placeholder: questionPlaceholder}); err == nil || !strings.Contains(err.Error(), "lacks the id, data and expires_at columns") {
+		t.Errorf("NewSQLStore on a legacy table: got %v", err)
+	}
+	if _, err := NewSQLStore(db, "session_sessions", Dialect{Placeholder: questionPlaceholder}); err != nil {
+		t.Errorf("NewSQLStore next to a legacy table: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package session
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by Store.Get for unknown sessions.
+	ErrNotFound = errors.New("session: not found")
+	// ErrKeyNotFound is returned by Session.Get for keys without a value.
+	ErrKeyNotFound = errors.New("session: key not found")
+)
+
+// Store persists encoded sessions by id. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Get returns the data of a session and when it expires.
+	Get(id string) ([]byte, time.Time, error)
+	// Set creates or replaces a session.
+	Set(id string, data []byte, expires time.Time) error
+	// Delete removes a session. Deleting an unknown session is not an error.
+	Delete(id string) error
+	// Touch moves the expiry of an existing session. It returns ErrNotFound
+	// if there is none.
+	Touch(id string, expires time.Time) error
+	// GC removes the sessions expired at now and returns how many it removed.
+	GC(now time.Time) (int, error)
+}
+
+type memoryEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// MemoryStore keeps sessions in process memory.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[string]memoryEntry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string]memoryEntry)}
+}
+
+func (m *MemoryStore) Get(id string) ([]byte, time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.data[id]
+	if !ok {
+		return nil, time.Time{}, ErrNotFound
+	}
+	return e.data, e.expires, nil
+}
+
+func (m *MemoryStore) Set(id string, data []byte, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[id] = memoryEntry{data: append([]byte(nil), data...), expires: expires}
+	return nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, id)
+	return nil
+}
+
+func (m *MemoryStore) Touch(id string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.data[id]
+	if !ok {
+		return ErrNotFound
+	}
+	e.expires = expires
+	m.data[id] = e
+	return nil
+}
+
+func (m *MemoryStore) GC(now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id, e := range m.data {
+		if !now.Before(e.expires) {
+			delete(m.data, id)
+			n++
+		}
+	}
+	return n, nil
+}
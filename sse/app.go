@@ -1,20 +1,254 @@
 package sse
 
 import (
+	"sort"
+	"strconv"
 	"sync"
+
+	"github.com/abdotop/octopus"
 )
 
+// SSEApp suit les connexions ouvertes et distribue les événements, à toutes
+// les connexions (Broadcast) ou à celles abonnées à un sujet (Publish).
 type SSEApp struct {
-	sync.Map
 	sync.RWMutex
+	conns  map[string]*Conn
+	topics map[string]map[string]*Conn // sujet -> id -> connexion
+	subs   map[string]map[string]bool  // id -> sujets
+	seq    uint64                      // numérotation sans ReplayLog
+	replay ReplayLog
 }
 
 func New() *SSEApp {
-	return new(SSEApp)
+	return &SSEApp{
+		conns:  make(map[string]*Conn),
+		topics: make(map[string]map[string]*Conn),
+		subs:   make(map[string]map[string]bool),
+	}
+}
+
+// UseReplay conserve les événements publiés dans log afin de les rejouer aux
+// clients qui se reconnectent avec un en-tête Last-Event-ID. log numérote
+// alors les événements.
+func (a *SSEApp) UseReplay(log ReplayLog) {
+	a.Lock()
+	defer a.Unlock()
+	a.replay = log
+}
+
+// ConnFrom ouvre une connexion SSE comme sse.ConnFrom, l'enregistre et
+// l'abonne à conf.Topics. Si le client envoie Last-Event-ID, les événements
+// manqués encore présents dans le ReplayLog sont renvoyés avant tout
+// événement publié ensuite.
+func (a *SSEApp) ConnFrom(c *octopus.Ctx, conf *ClientConfig) (*Conn, error) {
+	conn, err := ConnFrom(c, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// conn.mu bloque les Publish concurrents jusqu'à ce que le rejeu soit en
+	// file, pour qu'ils arrivent après lui.
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	a.Lock()
+	a.add(conn)
+	a.subscribe(conn, conf.Topics...)
+	missed := a.missed(conn.lastEventID, conf.Topics)
+	a.Unlock()
+
+	for i := range missed {
+		// Le rejeu ignore la taille de la file pour ne rien perdre
+		if err := conn.enqueueLocked(eventFrame(&missed[i].Event), true); err != nil {
+			break
+		}
+	}
+	return conn, nil
+}
+
+// missed retourne les événements postérieurs à lastEventID diffusés à tous
+// ou publiés sur topics, triés par séquence.
+func (a *SSEApp) missed(lastEventID string, topics []string) []Record {
+	if a.replay == nil || lastEventID == "" {
+		return nil
+	}
+	seq, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil {
+		return nil
+	}
+	records := a.replay.Since("", seq)
+	for _, topic := range topics {
+		records = append(records, a.replay.Since(topic, seq)...)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Seq < records[j].Seq })
+	for i := range records {
+		records[i].Event.ID = strconv.FormatUint(records[i].Seq, 10)
+	}
+	return records
+}
+
+// Add enregistre conn. Elle est retirée automatiquement une fois fermée.
+func (a *SSEApp) Add(conn *Conn) {
+	a.Lock()
+	a.add(conn)
+	a.Unlock()
+}
+
+func (a *SSEApp) add(conn *Conn) {
+	a.conns[conn.id] = conn
+	go func() {
+		<-conn.Done()
+		a.remove(conn)
+	}()
+}
+
+// remove retire conn et ses abonnements, sauf si une autre connexion a
+// entre-temps été enregistrée avec le même id.
+func (a *SSEApp) remove(conn *Conn) {
+	a.Lock()
+	defer a.Unlock()
+	if a.conns[conn.id] != conn {
+		return
+	}
+	delete(a.conns, conn.id)
+	for topic := range a.subs[conn.id] {
+		delete(a.topics[topic], conn.id)
+		if len(a.topics[topic]) == 0 {
+			delete(a.topics, topic)
+		}
+	}
+	delete(a.subs, conn.id)
+}
+
+// Get retourne la connexion ouverte avec cet id.
+func (a *SSEApp) Get(id string) (*Conn, bool) {
+	a.RLock()
+	defer a.RUnlock()
+	conn, ok := a.conns[id]
+	return conn, ok
 }
 
-// func (a *SSEApp) NewConn() *Conn {
-// 	a.Lock()
-// 	defer a.Unlock()
-// 	a.Store()
-// }
+// Len retourne le nombre de connexions ouvertes.
+func (a *SSEApp) Len() int {
+	a.RLock()
+	defer a.RUnlock()
+	return len(a.conns)
+}
+
+// Stats additionne les statistiques des files d'envoi des connexions
+// ouvertes. MaxQueued est la plus grande profondeur atteinte par l'une
+// d'elles.
+func (a *SSEApp) Stats() ConnStats {
+	a.RLock()
+	conns := make([]*Conn, 0, len(a.conns))
+	for _, conn := range a.conns {
+		conns = append(conns, conn)
+	}
+	a.RUnlock()
+
+	var total ConnStats
+	for _, conn := range conns {
+		s := conn.Stats()
+		total.Queued += s.Queued
+		total.Sent += s.Sent
+		total.Dropped += s.Dropped
+		if s.MaxQueued > total.MaxQueued {
+			total.MaxQueued = s.MaxQueued
+		}
+	}
+	return total
+}
+
+// Subscribe abonne la connexion id aux sujets donnés. Il retourne false si
+// aucune connexion ouverte n'a cet id.
+func (a *SSEApp) Subscribe(id string, topics ...string) bool {
+	a.Lock()
+	defer a.Unlock()
+	conn, ok := a.conns[id]
+	if !ok {
+		return false
+	}
+	a.subscribe(conn, topics...)
+	return true
+}
+
+func (a *SSEApp) subscribe(conn *Conn, topics ...string) {
+	id := conn.id
+	if a.subs[id] == nil {
+		a.subs[id] = make(map[string]bool)
+	}
+	for _, topic := range topics {
+		if a.topics[topic] == nil {
+			a.topics[topic] = make(map[string]*Conn)
+		}
+		a.topics[topic][id] = conn
+		a.subs[id][topic] = true
+	}
+}
+
+// Unsubscribe désabonne la connexion id des sujets donnés.
+func (a *SSEApp) Unsubscribe(id string, topics ...string) {
+	a.Lock()
+	defer a.Unlock()
+	for _, topic := range topics {
+		delete(a.topics[topic], id)
+		if len(a.topics[topic]) == 0 {
+			delete(a.topics, topic)
+		}
+		delete(a.subs[id], topic)
+	}
+}
+
+// Broadcast envoie e à toutes les connexions ouvertes et retourne le
+// nombre de connexions qui l'ont reçu. Le hub numérote l'événement : l'ID
+// envoyé est le numéro de séquence, celui de e est ignoré.
+func (a *SSEApp) Broadcast(e *Event) int {
+	a.Lock()
+	ev := a.record("", e)
+	targets := make([]*Conn, 0, len(a.conns))
+	for _, conn := range a.conns {
+		targets = append(targets, conn)
+	}
+	a.Unlock()
+	return deliver(targets, ev)
+}
+
+// Publish envoie e aux connexions abonnées à topic et retourne le nombre
+// de connexions qui l'ont reçu. Comme pour Broadcast, l'ID de l'événement
+// est attribué par le hub.
+func (a *SSEApp) Publish(topic string, e *Event) int {
+	a.Lock()
+	ev := a.record(topic, e)
+	targets := make([]*Conn, 0, len(a.topics[topic]))
+	for _, conn := range a.topics[topic] {
+		targets = append(targets, conn)
+	}
+	a.Unlock()
+	return deliver(targets, ev)
+}
+
+// record numérote une copie de e, par le ReplayLog s'il y en a un. Le verrou
+// du hub doit être tenu afin que l'ajout et la liste des destinataires
+// soient cohérents avec ConnFrom.
+func (a *SSEApp) record(topic string, e *Event) *Event {
+	ev := *e
+	var seq uint64
+	if a.replay != nil {
+		seq = a.replay.Append(topic, ev)
+	} else {
+		a.seq++
+		seq = a.seq
+	}
+	ev.ID = strconv.FormatUint(seq, 10)
+	return &ev
+}
+
+func deliver(targets []*Conn, e *Event) int {
+	n := 0
+	for _, conn := range targets {
+		if conn.Send(e) == nil {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,460 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abdotop/octopus"
+)
+
+func testConfig(id string) *ClientConfig {
+	conf := new(ClientConfig).Default()
+	conf.ID = id
+	conf.LoggingEnabled = false
+	return conf
+}
+
+// newTestServer serves an SSE endpoint registering its connections in hub
+// and subscribing them to the "topic" query parameter.
+func newTestServer(t *testing.T, hub *SSEApp) *httptest.Server {
+	t.Helper()
+	return newTestServerWith(t, hub, nil)
+}
+
+// newTestServerWith is newTestServer with a hook to adjust each connection's
+// configuration.
+func newTestServerWith(t *testing.T, hub *SSEApp, configure func(*ClientConfig)) *httptest.Server {
+	t.Helper()
+	app := octopus.New()
+	app.Get("/events", func(c *octopus.Ctx) error {
+		conf := testConfig(c.Query("id"))
+		if configure != nil {
+			configure(conf)
+		}
+		if topic := c.Query("topic"); topic != "" {
+			conf.Topics = []string{topic}
+		}
+		conn, err := hub.ConnFrom(c, conf)
+		if err != nil {
+			return err
+		}
+		<-conn.Done()
+		return nil
+	})
+	srv := httptest.NewServer(app)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// open connects to url and returns the "data:" lines received, one per
+// event.
+func open(t *testing.T, url string) chan string {
+	t.Helper()
+	return resume(t, url, "")
+}
+
+// resume is open with a Last-Event-ID header, when lastID is not empty.
+func resume(t *testing.T, url, lastID string) chan string {
+	t.Helper()
+	return stream(t, url, lastID, "data: ")
+}
+
+// stream connects to url and returns the lines starting with prefix,
+// without it.
+func stream(t *testing.T, url, lastID, prefix string) chan string {
+	t.Helper()
+	lines := make(chan string, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		body := bufio.NewReader(resp.Body)
+		for {
+			line, err := body.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(line, prefix) {
+				lines <- strings.TrimSuffix(strings.TrimPrefix(line, prefix), "\n")
+			}
+		}
+	}()
+	return lines
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func expect(t *testing.T, lines chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-lines:
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("timed out waiting for %q", want)
+	}
+}
+
+func TestHub(t *testing.T) {
+	hub := New()
+	srv := newTestServer(t, hub)
+
+	alice := open(t, srv.URL+"/events?id=alice&topic=sales")
+	bob := open(t, srv.URL+"/events?id=bob&topic=support")
+	waitFor(t, func() bool { return hub.Len() == 2 })
+
+	if _, ok := hub.Get("alice"); !ok {
+		t.Fatal("alice is not registered")
+	}
+
+	if n := hub.Publish("sales", NewEvent("", "new order")); n != 1 {
+		t.Errorf("Publish reached %d connections, want 1", n)
+	}
+	expect(t, alice, "new order")
+
+	if n := hub.Broadcast(NewEvent("notice", "maintenance")); n != 2 {
+		t.Errorf("Broadcast reached %d connections, want 2", n)
+	}
+	expect(t, alice, "maintenance")
+	expect(t, bob, "maintenance")
+
+	hub.Unsubscribe("alice", "sales")
+	if n := hub.Publish("sales", NewEvent("", "ignored")); n != 0 {
+		t.Errorf("Publish after Unsubscribe reached %d connections", n)
+	}
+
+	conn, _ := hub.Get("bob")
+	conn.Close()
+	waitFor(t, func() bool { return hub.Len() == 1 })
+	if _, ok := hub.Get("bob"); ok {
+		t.Error("closed connection is still registered")
+	}
+}
+
+// wrappedWriter hides the Flusher of the writer it wraps, as logging
+// middleware usually does, but exposes it through Unwrap.
+type wrappedWriter struct {
+	http.ResponseWriter
+}
+
+func (w *wrappedWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func TestWrappedWriter(t *testing.T) {
+	hub := New()
+	app := octopus.New()
+	app.Use(func(c *octopus.Ctx) error {
+		c.SetResponse(&wrappedWriter{c.Response()})
+		return c.Next()
+	})
+	app.Get("/events", func(c *octopus.Ctx) error {
+		conn, err := hub.ConnFrom(c, testConfig("alice"))
+		if err != nil {
+			return err
+		}
+		<-conn.Done()
+		return nil
+	})
+	srv := httptest.NewServer(app)
+	t.Cleanup(srv.Close)
+
+	alice := open(t, srv.URL+"/events")
+	waitFor(t, func() bool { return hub.Len() == 1 })
+	hub.Broadcast(NewEvent("", "through the wrapper"))
+	expect(t, alice, "through the wrapper")
+}
+
+func TestHead(t *testing.T) {
+	srv := newTestServer(t, New())
+	resp, err := http.Head(srv.URL + "/events?id=alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("HEAD: got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestReplay(t *testing.T) {
+	hub := New()
+	hub.UseReplay(NewMemoryReplay(10))
+	srv := newTestServer(t, hub)
+
+	hub.Publish("sales", NewEvent("", "one"))
+	hub.Publish("support", NewEvent("", "other topic"))
+	hub.Broadcast(NewEvent("", "two"))
+	hub.Publish("sales", NewEvent("", "three"))
+
+	// The client saw event 1 before losing its connection.
+	lines := resume(t, srv.URL+"/events?id=alice&topic=sales", "1")
+	expect(t, lines, "two")
+	expect(t, lines, "three")
+
+	waitFor(t, func() bool { return hub.Len() == 1 })
+	hub.Publish("sales", NewEvent("", "live"))
+	expect(t, lines, "live")
+
+	// Without Last-Event-ID nothing is replayed.
+	fresh := open(t, srv.URL+"/events?id=bob&topic=sales")
+	waitFor(t, func() bool { return hub.Len() == 2 })
+	hub.Publish("sales", NewEvent("", "after"))
+	expect(t, fresh, "after")
+}
+
+func TestMemoryReplay(t *testing.T) {
+	log := NewMemoryReplay(3)
+	for i := uint64(1); i <= 5; i++ {
+		if seq := log.Append("t", Event{Data: strconv.FormatUint(i, 10)}); seq != i {
+			t.Errorf("Append returned %d, want %d", seq, i)
+		}
+	}
+	var got []string
+	for _, r := range log.Since("t", 2) {
+		got = append(got, r.Event.Data)
+	}
+	if strings.Join(got, ",") != "3,4,5" {
+		t.Errorf("Since(2) = %v, want [3 4 5]", got)
+	}
+	if n := len(log.Since("t", 4)); n != 1 {
+		t.Errorf("Since(4) returned %d records, want 1", n)
+	}
+	if log.Since("unknown", 0) != nil {
+		t.Error("Since on an unknown topic returned records")
+	}
+	// Numbers are shared by all topics
+	if seq := log.Append("other", Event{}); seq != 6 {
+		t.Errorf("Append on another topic returned %d, want 6", seq)
+	}
+}
+
+func TestSharedConfig(t *testing.T) {
+	conf := &ClientConfig{}
+	app := octopus.New()
+	app.Get("/events", func(c *octopus.Ctx) error {
+		conn, err := ConnFrom(c, conf)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+		<-conn.Done()
+		return nil
+	})
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp, err := http.Get(srv.URL + "/events"); err == nil {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	if conf.QueueSize != 0 {
+		t.Errorf("ConnFrom changed the shared config: QueueSize = %d", conf.QueueSize)
+	}
+}
+
+func TestReplayAcrossRestart(t *testing.T) {
+	// The log outlives the hub, as a persistent one would
+	log := NewMemoryReplay(10)
+	before := New()
+	before.UseReplay(log)
+	before.Publish("sales", NewEvent("", "one"))
+	before.Publish("sales", NewEvent("", "two"))
+
+	hub := New()
+	hub.UseReplay(log)
+	srv := newTestServer(t, hub)
+	hub.Publish("sales", NewEvent("", "three"))
+
+	lines := stream(t, srv.URL+"/events?id=alice&topic=sales", "2", "id: ")
+	expect(t, lines, "3")
+	waitFor(t, func() bool { return hub.Len() == 1 })
+	hub.Publish("sales", NewEvent("", "four"))
+	expect(t, lines, "4")
+}
+
+func TestHeartbeat(t *testing.T) {
+	hub := New()
+	beats := make(chan error, 16)
+	srv := newTestServerWith(t, hub, func(conf *ClientConfig) {
+		conf.HeartbeatInterval = 10 * time.Millisecond
+		conf.OnHeartbeat = func(conn *Conn, err error) {
+			select {
+			case beats <- err:
+			default:
+			}
+		}
+	})
+
+	comments := stream(t, srv.URL+"/events?id=alice", "", ": ")
+	expect(t, comments, "ping")
+	select {
+	case err := <-beats:
+		if err != nil {
+			t.Errorf("OnHeartbeat got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("OnHeartbeat was not called")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	hub := New()
+	timedOut := make(chan string, 1)
+	srv := newTestServerWith(t, hub, func(conf *ClientConfig) {
+		conf.ConnectionTimeout = 100 * time.Millisecond
+		conf.HeartbeatInterval = 10 * time.Millisecond
+		conf.OnIdleTimeout = func(conn *Conn) { timedOut <- conn.ID() }
+	})
+
+	lines := open(t, srv.URL+"/events?id=alice")
+	waitFor(t, func() bool { return hub.Len() == 1 })
+
+	// Events keep the connection alive, heartbeats do not.
+	for i := 0; i < 3; i++ {
+		time.Sleep(50 * time.Millisecond)
+		hub.Broadcast(NewEvent("", "tick"))
+		expect(t, lines, "tick")
+	}
+	if hub.Len() != 1 {
+		t.Fatal("connection closed while events were being sent")
+	}
+
+	select {
+	case id := <-timedOut:
+		if id != "alice" {
+			t.Errorf("OnIdleTimeout got %q", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("idle connection was not closed")
+	}
+	expect(t, lines, "Server closing connection")
+	waitFor(t, func() bool { return hub.Len() == 0 })
+}
+
+// stalledConn returns a Conn whose queue is never drained, as if its client
+// had stopped reading.
+func stalledConn(size int, policy OverflowPolicy) *Conn {
+	return &Conn{
+		config: &ClientConfig{QueueSize: size, Overflow: policy},
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+func queued(c *Conn) []string {
+	var data []string
+	for _, f := range c.queue {
+		data = append(data, f.event.Data)
+	}
+	return data
+}
+
+func TestOverflow(t *testing.T) {
+	tests := []struct {
+		policy  OverflowPolicy
+		errs    int
+		want    string
+		dropped uint64
+	}{
+		{DropOldest, 0, "3,4", 2},
+		{DropNewest, 2, "1,2", 2},
+		{Disconnect, 2, "", 3},
+	}
+	for _, tt := range tests {
+		conn := stalledConn(2, tt.policy)
+		errs := 0
+		for i := 1; i <= 4; i++ {
+			if err := conn.SendText(strconv.Itoa(i)); err != nil {
+				errs++
+			}
+		}
+		if errs != tt.errs {
+			t.Errorf("policy %d: %d sends failed, want %d", tt.policy, errs, tt.errs)
+		}
+		if got := strings.Join(queued(conn), ","); got != tt.want {
+			t.Errorf("policy %d: queue = %q, want %q", tt.policy, got, tt.want)
+		}
+		stats := conn.Stats()
+		if stats.Dropped != tt.dropped || stats.MaxQueued != 2 {
+			t.Errorf("policy %d: stats = %+v", tt.policy, stats)
+		}
+	}
+}
+
+func TestConcurrentSends(t *testing.T) {
+	hub := New()
+	srv := newTestServerWith(t, hub, func(conf *ClientConfig) {
+		conf.QueueSize = 1000
+	})
+	lines := open(t, srv.URL+"/events?id=alice")
+	waitFor(t, func() bool { return hub.Len() == 1 })
+	conn, _ := hub.Get("alice")
+
+	const senders, each = 8, 50
+	for s := 0; s < senders; s++ {
+		go func(s int) {
+			for i := 0; i < each; i++ {
+				conn.SendText(strconv.Itoa(s*each + i))
+			}
+		}(s)
+	}
+
+	// Every event arrives whole and each sender's events stay in order.
+	last := make(map[int]int)
+	for n := 0; n < senders*each; n++ {
+		select {
+		case line := <-lines:
+			v, err := strconv.Atoi(line)
+			if err != nil {
+				t.Fatalf("corrupted event %q", line)
+			}
+			s := v / each
+			if prev, ok := last[s]; ok && v <= prev {
+				t.Fatalf("sender %d: %d arrived after %d", s, v, prev)
+			}
+			last[s] = v
+		case <-time.After(2 * time.Second):
+			t.Fatalf("received %d events, want %d", n, senders*each)
+		}
+	}
+	waitFor(t, func() bool { return hub.Stats().Sent == senders*each })
+	if s := hub.Stats(); s.Dropped != 0 || s.Queued != 0 {
+		t.Errorf("hub stats = %+v", s)
+	}
+}
@@ -0,0 +1,233 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrNoContent est l'erreur d'un Client arrêté par une réponse 204, la
+// manière prévue par la spécification de demander au client de ne plus se
+// reconnecter.
+var ErrNoContent = errors.New("sse: server answered 204 No Content")
+
+// DialOptions configure un Client. Le zéro est utilisable.
+type DialOptions struct {
+	// Client envoie les requêtes. Par défaut http.DefaultClient.
+	Client *http.Client
+	// Header est ajouté à chaque requête.
+	Header http.Header
+	// Context arrête le Client quand il est annulé.
+	Context context.Context
+
+	// LastEventID est envoyé lors de la première connexion, pour reprendre
+	// un flux déjà lu.
+	LastEventID string
+	// Retry est le délai avant une reconnexion tant que le serveur n'en a pas
+	// envoyé. Par défaut 3 secondes.
+	Retry time.Duration
+	// MaxRetries limite le nombre de reconnexions consécutives qui échouent.
+	// 0 n'impose pas de limite ; une valeur négative désactive la reconnexion.
+	MaxRetries int
+	// BufferSize est la capacité du canal Events. Par défaut 16.
+	BufferSize int
+}
+
+// Client lit un flux text/event-stream et se reconnecte quand il est coupé,
+// en respectant le délai retry: du serveur et en envoyant Last-Event-ID.
+type Client struct {
+	url    string
+	opts   DialOptions
+	events chan *Event
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	lastID string
+	retry  time.Duration
+	err    error
+}
+
+// Dial se connecte à url et retourne un Client dont les événements arrivent
+// sur Events. Il échoue si la première connexion n'aboutit pas à un flux.
+func Dial(url string, opts *DialOptions) (*Client, error) {
+	var o DialOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Client == nil {
+		o.Client = http.DefaultClient
+	}
+	if o.Context == nil {
+		o.Context = context.Background()
+	}
+	if o.Retry <= 0 {
+		o.Retry = 3 * time.Second
+	}
+	if o.BufferSize <= 0 {
+		o.BufferSize = 16
+	}
+
+	ctx, cancel := context.WithCancel(o.Context)
+	c := &Client{
+		url:    url,
+		opts:   o,
+		events: make(chan *Event, o.BufferSize),
+		ctx:    ctx,
+		cancel: cancel,
+		lastID: o.LastEventID,
+		retry:  o.Retry,
+	}
+	body, _, err := c.connect()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go c.run(body)
+	return c, nil
+}
+
+// Events retourne le canal des événements reçus. Il est fermé quand le
+// Client s'arrête ; Err en donne alors la raison.
+func (c *Client) Events() <-chan *Event {
+	return c.events
+}
+
+// LastEventID retourne le dernier id reçu.
+func (c *Client) LastEventID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastID
+}
+
+// Err retourne la dernière erreur rencontrée : fin du flux, échec de
+// connexion ou réponse refusée. Une fois Events fermé, c'est la raison de
+// l'arrêt, sauf après Close.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close arrête le Client et ferme Events.
+func (c *Client) Close() error {
+	c.cancel()
+	return nil
+}
+
+// connect ouvre le flux. fatal indique une erreur après laquelle il ne faut
+// pas se reconnecter.
+func (c *Client) connect() (body io.ReadCloser, fatal bool, err error) {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, true, err
+	}
+	for key, values := range c.opts.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if id := c.LastEventID(); id != "" {
+		req.Header.Set("Last-Event-ID", id)
+	}
+
+	resp, err := c.opts.Client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		resp.Body.Close()
+		return nil, true, ErrNoContent
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, true, fmt.Errorf("sse: unexpected status %s", resp.Status)
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/event-stream" {
+		resp.Body.Close()
+		return nil, true, fmt.Errorf("sse: unexpected content type %q", mt)
+	}
+	return resp.Body, false, nil
+}
+
+// run lit les flux successifs jusqu'à l'arrêt du Client.
+func (c *Client) run(body io.ReadCloser) {
+	defer close(c.events)
+	defer c.cancel()
+
+	failures := 0
+	for {
+		if body != nil {
+			c.read(body)
+			body.Close()
+		}
+		if c.ctx.Err() != nil {
+			return
+		}
+		if c.opts.MaxRetries < 0 || (c.opts.MaxRetries > 0 && failures >= c.opts.MaxRetries) {
+			return
+		}
+
+		c.mu.Lock()
+		delay := c.retry
+		c.mu.Unlock()
+		select {
+		case <-time.After(delay):
+		case <-c.ctx.Done():
+			return
+		}
+
+		var fatal bool
+		var err error
+		body, fatal, err = c.connect()
+		if err != nil {
+			c.setErr(err)
+			if fatal {
+				return
+			}
+			failures++
+			continue
+		}
+		failures = 0
+		c.setErr(nil)
+	}
+}
+
+// read transmet les événements de body jusqu'à la fin du flux.
+func (c *Client) read(body io.Reader) {
+	d := NewDecoder(body)
+	c.mu.Lock()
+	d.lastID, d.retry = c.lastID, c.retry
+	c.mu.Unlock()
+
+	for {
+		e, err := d.Decode()
+
+		c.mu.Lock()
+		c.lastID, c.retry = d.LastEventID(), d.Retry()
+		c.mu.Unlock()
+
+		if err != nil {
+			if c.ctx.Err() == nil {
+				c.setErr(err)
+			}
+			return
+		}
+		select {
+		case c.events <- e:
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Client) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
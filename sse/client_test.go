@@ -0,0 +1,126 @@
+package sse
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func next(t *testing.T, c *Client) *Event {
+	t.Helper()
+	select {
+	case e, ok := <-c.Events():
+		if !ok {
+			t.Fatalf("Events closed: %v", c.Err())
+		}
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return nil
+}
+
+func TestClientReconnects(t *testing.T) {
+	hub := New()
+	hub.UseReplay(NewMemoryReplay(10))
+	srv := newTestServerWith(t, hub, func(conf *ClientConfig) {
+		conf.RetryInterval = 20 * time.Millisecond
+	})
+
+	c, err := Dial(srv.URL+"/events?id=alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitFor(t, func() bool { return hub.Len() == 1 })
+
+	hub.Broadcast(&Event{Type: "order", Data: "line 1\nline 2"})
+	e := next(t, c)
+	if e.ID != "1" || e.Type != "order" || e.Data != "line 1\nline 2" {
+		t.Errorf("got %+v", e)
+	}
+
+	// The server drops the stream: events published until the client is back
+	// are replayed from Last-Event-ID, the others arrive live.
+	conn, _ := hub.Get("alice")
+	conn.Close()
+	if e := next(t, c); e.Type != "close" {
+		t.Errorf("got %+v, want the close event", e)
+	}
+	for i := 0; i < 3; i++ {
+		hub.Broadcast(NewEvent("", "after close"))
+	}
+	for _, want := range []string{"2", "3", "4"} {
+		if e := next(t, c); e.ID != want {
+			t.Errorf("got event %q, want %q", e.ID, want)
+		}
+	}
+	if c.LastEventID() != "4" {
+		t.Errorf("LastEventID = %q", c.LastEventID())
+	}
+
+	c.Close()
+	select {
+	case _, ok := <-c.Events():
+		for ok {
+			_, ok = <-c.Events()
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Events not closed after Close")
+	}
+}
+
+func TestClientRetryField(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("retry: 1500\ndata: x\n\n"))
+	}))
+	defer srv.Close()
+
+	c, err := Dial(srv.URL, &DialOptions{MaxRetries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := next(t, c); e.Retry != 1500*time.Millisecond || e.Data != "x" {
+		t.Errorf("got %+v", e)
+	}
+	if _, ok := <-c.Events(); ok {
+		t.Error("client reconnected with MaxRetries < 0")
+	}
+}
+
+func TestClientStops(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: once\n\n"))
+		case 2:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := Dial(srv.URL, &DialOptions{Retry: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := next(t, c); e.Data != "once" {
+		t.Errorf("got %+v", e)
+	}
+	for range c.Events() {
+	}
+	if !errors.Is(c.Err(), ErrNoContent) {
+		t.Errorf("Err = %v, want ErrNoContent", c.Err())
+	}
+
+	if _, err := Dial(srv.URL, nil); err == nil {
+		t.Error("Dial succeeded on a 404")
+	}
+}
@@ -6,8 +6,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -27,8 +28,23 @@ type (
 		RetryInterval time.Duration
 
 		// ConnectionTimeout spécifie la durée après laquelle une connexion inactive doit être fermée.
+		// Une connexion est inactive tant qu'aucun événement n'est envoyé : les
+		// heartbeats ne comptent pas. 0 désactive la fermeture.
 		ConnectionTimeout time.Duration
 
+		// HeartbeatInterval spécifie l'intervalle entre deux commentaires
+		// ": ping" qui empêchent les proxys de couper le flux. 0 les désactive.
+		HeartbeatInterval time.Duration
+
+		// OnHeartbeat, s'il est défini, est appelé après chaque heartbeat avec
+		// l'erreur éventuelle de mise en file (ErrClosed si la connexion est
+		// fermée).
+		OnHeartbeat func(conn *Conn, err error)
+
+		// OnIdleTimeout, s'il est défini, est appelé quand la connexion est
+		// fermée faute d'activité pendant ConnectionTimeout.
+		OnIdleTimeout func(conn *Conn)
+
 		// EnableCORS indique si les en-têtes CORS doivent être ajoutés aux réponses.
 		EnableCORS bool
 
@@ -38,27 +54,60 @@ type (
 		// UseHTTPS indique si HTTPS doit être utilisé pour sécuriser les connexions.
 		UseHTTPS bool
 
-		// CompressionEnabled indique si la compression des données est activée.
+		// CompressionEnabled active la compression gzip du flux lorsque le
+		// client l'accepte (en-tête Accept-Encoding).
 		CompressionEnabled bool
 
 		// LoggingEnabled indique si le logging est activé pour les événements SSE.
 		LoggingEnabled bool
+
+		// QueueSize est le nombre d'événements qui peuvent attendre d'être
+		// écrits vers un client lent. Par défaut 64.
+		QueueSize int
+
+		// Overflow décide du sort des événements quand la file est pleine.
+		Overflow OverflowPolicy
+
+		// Topics liste les sujets auxquels SSEApp.ConnFrom abonne la connexion
+		// avant de rejouer les événements manqués.
+		Topics []string
 	}
 
 	Conn struct {
 		id      string
 		writer  http.ResponseWriter
-		flusher http.Flusher
-		closeCh chan bool
+		rc      *http.ResponseController
+		gz      *gzip.Writer // Non nil si le flux est compressé
+		done    chan struct{}
 		context context.Context
-		closed  bool
+		appDone <-chan struct{}
 		config  *ClientConfig
-		mu      sync.Mutex // Mutex pour la gestion sûre de la fermeture
+
+		// writer et gz n'appartiennent qu'au goroutine run une fois la
+		// connexion ouverte ; mu protège la file et l'état.
+		mu      sync.Mutex
+		queue   []frame
+		wake    chan struct{}
+		closing bool // Close() appelé : run termine une fois la file vidée
+		abort   bool // La file a débordé avec la politique Disconnect
+		closed  bool // run a terminé
+		stats   ConnStats
+
+		lastEventID string
+		lastSent    time.Time // Dernier événement envoyé
 	}
 
+	// Event est un message SSE. Type est vide pour les messages par défaut.
+	// ID, s'il est renseigné, est renvoyé par le navigateur dans l'en-tête
+	// Last-Event-ID lorsqu'il se reconnecte. SSEApp.Broadcast et Publish le
+	// remplacent par le numéro de séquence de l'événement. Retry, s'il est
+	// positif, change le délai de reconnexion du client.
 	Event struct {
-		eventType string
-		conn      *Conn
+		ID    string
+		Type  string
+		Data  string
+		Retry time.Duration
+		conn  *Conn
 	}
 )
 
@@ -73,11 +122,14 @@ func (c *ClientConfig) Default() *ClientConfig {
 		},
 		RetryInterval:      3000 * time.Millisecond,
 		ConnectionTimeout:  5 * time.Minute,
+		HeartbeatInterval:  15 * time.Second,
 		EnableCORS:         true,
 		CORSOrigin:         "*",
 		UseHTTPS:           false,
 		CompressionEnabled: false,
 		LoggingEnabled:     true,
+		QueueSize:          64,
+		Overflow:           DropOldest,
 	}
 }
 
@@ -88,152 +140,247 @@ func ConnFrom(c *octopus.Ctx, conf *ClientConfig) (*Conn, error) {
 	}
 
 	// Retrieve the http.ResponseWriter from the context
-	w_value, ok := c.Values.Get("response")
-	if !ok {
+	w := c.Response()
+	if w == nil {
 		return nil, fmt.Errorf("failed to get Writer from context")
 	}
-	w, ok := w_value.(http.ResponseWriter)
-	if !ok {
-		return nil, fmt.Errorf("failed to assert Writer from context")
-	}
 
-	// Check if the ResponseWriter supports flushing
-	flusher, ok := w.(http.Flusher)
-	if !ok {
+	// Check if the ResponseWriter, or one it wraps, supports flushing
+	if !flushable(w) {
 		return nil, fmt.Errorf("streaming unsupported")
 	}
 
-	r_value, ok := c.Values.Get("request")
-	if !ok {
-		return nil, fmt.Errorf("failed to get Writer from context")
+	r := c.Request()
+	if r == nil {
+		return nil, fmt.Errorf("failed to get Request from context")
 	}
-	r, ok := r_value.(*http.Request)
-	if !ok {
-		return nil, fmt.Errorf("failed to get Writer from context")
+
+	// Streams end when the App shuts down so that it can drain
+	var appDone <-chan struct{}
+	if app := c.App(); app != nil {
+		appDone = app.Done()
+	}
+
+	// Les valeurs par défaut vont dans une copie : conf peut être partagée
+	// entre les requêtes
+	config := *conf
+	if config.QueueSize <= 0 {
+		config.QueueSize = 64
 	}
 
 	// Create and return the Conn instance
 	conn := &Conn{
-		id:      conf.ID,
+		id:      config.ID,
 		writer:  w,
-		flusher: flusher,
-		closeCh: make(chan bool),
+		rc:      http.NewResponseController(w),
+		done:    make(chan struct{}),
 		context: r.Context(),
-		closed:  false,
-		config:  conf,
-		mu:      sync.Mutex{},
+		appDone: appDone,
+		config:  &config,
+		wake:    make(chan struct{}, 1),
+
+		lastEventID: r.Header.Get("Last-Event-ID"),
+		lastSent:    time.Now(),
+	}
+	if err := conn.open(r); err != nil {
+		return nil, err
 	}
+	go conn.run()
+	go conn.watch()
 
 	return conn, nil
 }
 
-// compress prend une chaîne de caractères et la compresse en utilisant gzip.
-func compress(data string) ([]byte, error) {
+// flushable indique si w, ou l'un des writers qu'il enveloppe via Unwrap,
+// sait vider sa sortie : c'est ce que http.ResponseController utilisera.
+func flushable(w http.ResponseWriter) bool {
+	for {
+		switch t := w.(type) {
+		case http.Flusher, interface{ FlushError() error }:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// open envoie les en-têtes et le délai de reconnexion, une seule fois avant
+// tout événement.
+func (c *Conn) open(r *http.Request) error {
+	h := c.writer.Header()
+	for key, value := range c.config.HeaderFields {
+		h.Set(key, value)
+	}
+	// Gérer CORS si activé
+	if c.config.EnableCORS {
+		h.Set("Access-Control-Allow-Origin", c.config.CORSOrigin)
+	}
+	if c.config.CompressionEnabled {
+		h.Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			h.Set("Content-Encoding", "gzip")
+			h.Del("Content-Length")
+			c.gz = gzip.NewWriter(c.writer)
+		}
+	}
+	c.writer.WriteHeader(http.StatusOK)
+
 	var b bytes.Buffer
-	gz := gzip.NewWriter(&b)
-	if _, err := gz.Write([]byte(data)); err != nil {
-		gz.Close()
-		return nil, err
+	if c.config.RetryInterval > 0 {
+		encodeRetry(&b, c.config.RetryInterval)
 	}
-	if err := gz.Close(); err != nil {
-		return nil, err
+	return c.write(b.Bytes())
+}
+
+// acceptsGzip indique si l'en-tête Accept-Encoding autorise gzip, en
+// tenant compte des poids q=0 et du joker "*".
+func acceptsGzip(header string) bool {
+	gzipQ, wildcardQ := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "gzip", "x-gzip":
+			gzipQ = q
+		case "*":
+			wildcardQ = q
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
 	}
-	return b.Bytes(), nil
+	return wildcardQ > 0
 }
 
-// Close marque la connexion comme fermée et ferme le canal closeCh.
-func (c *Conn) Close() (err error) {
+// Close envoie un événement "close" au client et ferme la connexion. Les
+// événements déjà en file sont écrits avant ; Done est fermé ensuite.
+func (c *Conn) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if !c.closed {
-		err = c.send("close", "Server closing connection")
-		c.closed = true
-		close(c.closeCh)
+	if c.closing || c.closed || c.abort {
+		return nil
 	}
+	err := c.enqueueLocked(eventFrame(&Event{Type: "close", Data: "Server closing connection"}), true)
+	c.closing = true
+	c.signal()
 	return err
 }
 
-// Done retourne un canal qui est fermé lorsque la connexion est fermée.
-// Ce canal est fermé en réponse à la fermeture de closeCh ou du contexte.
-func (c *Conn) Done() <-chan struct{} {
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
+// watch envoie les heartbeats et ferme la connexion quand le client se
+// déconnecte, qu'elle est inactive depuis ConnectionTimeout ou que l'App
+// s'arrête.
+func (c *Conn) watch() {
+	var heartbeat, idle <-chan time.Time
+	if c.config.HeartbeatInterval > 0 {
+		ticker := time.NewTicker(c.config.HeartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	var idleTimer *time.Timer
+	if c.config.ConnectionTimeout > 0 {
+		idleTimer = time.NewTimer(c.config.ConnectionTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+
+	for {
 		select {
-		case <-c.closeCh:
-			// La fermeture a été initiée par Close()
+		case <-c.done:
+			// Fermée par Close(), un débordement ou une erreur d'écriture
+			return
 		case <-c.context.Done():
-			c.mu.Lock()
-			if !c.closed {
-				c.closed = true
-				close(c.closeCh) // Assurez-vous de fermer closeCh également ici
+			// Le client est parti : run s'arrête de lui-même
+			return
+		case <-c.appDone:
+			// L'App s'arrête : on prévient le client avant de fermer
+			c.Close()
+			return
+		case <-heartbeat:
+			err := c.ping()
+			if c.config.OnHeartbeat != nil {
+				c.config.OnHeartbeat(c, err)
 			}
+		case <-idle:
+			c.mu.Lock()
+			remaining := c.config.ConnectionTimeout - time.Since(c.lastSent)
 			c.mu.Unlock()
-			// La fermeture a été initiée par le contexte parent
+			if remaining > 0 {
+				// Un événement a été envoyé depuis : on réarme
+				idleTimer.Reset(remaining)
+				continue
+			}
+			c.Close()
+			if c.config.OnIdleTimeout != nil {
+				c.config.OnIdleTimeout(c)
+			}
+			return
 		}
-	}()
-	return done
+	}
 }
 
-func (c *Conn) ID() string {
-	return c.id
+// ping met en file un commentaire ": ping", sauf si des messages attendent
+// déjà d'être écrits.
+func (c *Conn) ping() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.queue) > 0 {
+		return nil
+	}
+	return c.enqueueLocked(commentFrame("ping"), true)
 }
 
-// SendEvent envoie un événement SSE avec un type et des données spécifiés, en respectant la configuration.
-func (c *Conn) send(eventType, data string) error {
-	if c.closed {
-		return fmt.Errorf("connection is closed")
-	}
+// Done retourne un canal qui est fermé lorsque la connexion est fermée,
+// que ce soit par Close(), par le client ou par l'arrêt de l'App.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
 
-	// Appliquer les en-têtes personnalisés
-	for key, value := range c.config.HeaderFields {
-		c.writer.Header().Set(key, value)
-	}
+func (c *Conn) ID() string {
+	return c.id
+}
 
-	// Ajouter l'ID de la connexion dans les en-têtes HTTP
-	// c.Writer.Header().Set("X-Connection-ID", c.ID)
+// LastEventID retourne l'en-tête Last-Event-ID envoyé par le client qui se
+// reconnecte, ou une chaîne vide.
+func (c *Conn) LastEventID() string {
+	return c.lastEventID
+}
 
-	// Gérer CORS si activé
-	if c.config.EnableCORS {
-		c.writer.Header().Set("Access-Control-Allow-Origin", c.config.CORSOrigin)
-	}
+// send met e dans la file d'envoi de la connexion.
+func (c *Conn) send(e *Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enqueueLocked(eventFrame(e), false)
+}
 
-	// Compresser les données si la compression est activée
-	if c.config.CompressionEnabled {
-		compressedData, err := compress(data)
-		if err != nil {
-			return fmt.Errorf("compression error: %v", err)
+// write écrit et flush message, à travers le flux gzip s'il y en a un.
+func (c *Conn) write(message []byte) error {
+	if c.gz != nil {
+		if _, err := c.gz.Write(message); err != nil {
+			return err
 		}
-		data = string(compressedData)
-		c.writer.Header().Set("Content-Encoding", "gzip")
-	}
-
-	// Préparer le message SSE
-	message := fmt.Sprintf("event: %s\n", eventType)
-	if c.config.RetryInterval > 0 {
-		message += fmt.Sprintf("retry: %d\n", c.config.RetryInterval.Milliseconds())
-	}
-	message += fmt.Sprintf("data: %s\n\n", data)
-
-	// Envoyer le message
-	_, err := c.writer.Write([]byte(message))
-	if err != nil {
+		if err := c.gz.Flush(); err != nil {
+			return err
+		}
+	} else if _, err := c.writer.Write(message); err != nil {
 		return err
 	}
 
-	// Flush si possible
-	if flusher, ok := c.writer.(http.Flusher); ok {
-		flusher.Flush()
-	} else {
-		return fmt.Errorf("failed to flush data")
-	}
-
-	// Logging si activé
-	if c.config.LoggingEnabled {
-		log.Printf("Sent SSE event: %s, Data: %s", eventType, data)
-	}
+	return c.rc.Flush()
+}
 
-	return nil
+// Comment envoie un commentaire, ignoré par le client. Il peut servir à
+// garder le flux actif sans déclencher d'événement.
+func (c *Conn) Comment(text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enqueueLocked(commentFrame(text), false)
 }
 
 // SendJSON envoie des données JSON sur une connexion SSE.
@@ -242,33 +389,54 @@ func (c *Conn) SendJSON(data interface{}) error {
 	if err != nil {
 		return err
 	}
-	return c.send("", string(jsonData))
+	return c.send(&Event{Data: string(jsonData)})
 }
 
 // SendText envoie des données textuelles sur une connexion SSE.
 func (c *Conn) SendText(data string) error {
-	return c.send("", data)
+	return c.send(&Event{Data: data})
+}
+
+// Send envoie un événement déjà construit sur la connexion.
+func (c *Conn) Send(e *Event) error {
+	return c.send(e)
 }
 
-// SendEvent envoie un événement SSE avec un type et des données spécifiés, en respectant la configuration.
+// Event prépare un événement du type donné à envoyer sur la connexion.
 func (c *Conn) Event(eventType string) *Event {
 	return &Event{
-		eventType: eventType,
-		conn:      c,
+		Type: eventType,
+		conn: c,
 	}
 }
 
+// NewEvent crée un événement texte, à envoyer avec Send, Broadcast ou
+// Publish.
+func NewEvent(eventType, data string) *Event {
+	return &Event{Type: eventType, Data: data}
+}
+
+// JSONEvent crée un événement dont les données sont v encodé en JSON.
+func JSONEvent(eventType string, v interface{}) (*Event, error) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{Type: eventType, Data: string(jsonData)}, nil
+}
+
 // SendJSON envoie des données JSON sur une connexion SSE.
 func (e *Event) SendJSON(data interface{}) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
-
-	return e.conn.send(e.eventType, string(jsonData))
+	e.Data = string(jsonData)
+	return e.conn.Send(e)
 }
 
 // SendText envoie des données textuelles sur une connexion SSE.
 func (e *Event) SendText(data string) error {
-	return e.conn.send(e.eventType, data)
+	e.Data = data
+	return e.conn.Send(e)
 }
@@ -0,0 +1,177 @@
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// newlines découpe un texte selon les fins de ligne reconnues par la
+// spécification : CRLF, CR seul ou LF seul.
+var newlines = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// singleLine retire les caractères qui couperaient un champ id: ou event:.
+// NUL est aussi retiré de l'id, que les navigateurs ignoreraient sinon.
+var singleLine = strings.NewReplacer("\r", "", "\n", "", "\x00", "")
+
+// encodeEvent écrit e au format text/event-stream dans b. Les données sur
+// plusieurs lignes sont envoyées comme autant de champs data:.
+func encodeEvent(b *bytes.Buffer, e *Event) {
+	if e.ID != "" {
+		b.WriteString("id: ")
+		b.WriteString(singleLine.Replace(e.ID))
+		b.WriteByte('\n')
+	}
+	if e.Type != "" {
+		b.WriteString("event: ")
+		b.WriteString(singleLine.Replace(e.Type))
+		b.WriteByte('\n')
+	}
+	if e.Retry > 0 {
+		b.WriteString("retry: ")
+		b.WriteString(strconv.FormatInt(e.Retry.Milliseconds(), 10))
+		b.WriteByte('\n')
+	}
+	for _, line := range strings.Split(newlines.Replace(e.Data), "\n") {
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+}
+
+// encodeComment écrit un commentaire, ignoré par les clients mais qui garde
+// le flux actif.
+func encodeComment(b *bytes.Buffer, text string) {
+	for _, line := range strings.Split(newlines.Replace(text), "\n") {
+		b.WriteString(": ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+}
+
+// encodeRetry indique au client le délai à respecter avant de se reconnecter.
+func encodeRetry(b *bytes.Buffer, d time.Duration) {
+	b.WriteString("retry: ")
+	b.WriteString(strconv.FormatInt(d.Milliseconds(), 10))
+	b.WriteString("\n\n")
+}
+
+// Decoder lit les événements d'un flux text/event-stream en suivant
+// l'algorithme d'analyse de la spécification HTML.
+type Decoder struct {
+	r       *bufio.Reader
+	started bool
+	lastID  string
+	retry   time.Duration
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Retry retourne le dernier délai de reconnexion reçu, ou 0.
+func (d *Decoder) Retry() time.Duration {
+	return d.retry
+}
+
+// LastEventID retourne le dernier id reçu, à renvoyer dans l'en-tête
+// Last-Event-ID lors d'une reconnexion.
+func (d *Decoder) LastEventID() string {
+	return d.lastID
+}
+
+// Decode retourne le prochain événement du flux. L'ID de l'événement est le
+// dernier id reçu, même s'il a été envoyé avec un événement précédent ;
+// Retry n'est renseigné que si l'événement contenait un champ retry:. Il
+// retourne io.EOF à la fin du flux ; un événement incomplet est abandonné.
+func (d *Decoder) Decode() (*Event, error) {
+	var (
+		data    strings.Builder
+		hasData bool
+		typ     string
+		retry   time.Duration
+	)
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			if !hasData {
+				// Rien à dispatcher : on repart de zéro
+				typ, retry = "", 0
+				continue
+			}
+			return &Event{ID: d.lastID, Type: typ, Data: strings.TrimSuffix(data.String(), "\n"), Retry: retry}, nil
+		}
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "event":
+			typ = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				d.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); isDigits(value) && err == nil {
+				d.retry = time.Duration(ms) * time.Millisecond
+				retry = d.retry
+			}
+		}
+	}
+}
+
+// readLine lit une ligne terminée par CRLF, CR ou LF, sans sa fin de ligne.
+func (d *Decoder) readLine() (string, error) {
+	var b strings.Builder
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case '\n':
+			return d.trimBOM(b.String()), nil
+		case '\r':
+			if next, err := d.r.Peek(1); err == nil && next[0] == '\n' {
+				d.r.ReadByte()
+			}
+			return d.trimBOM(b.String()), nil
+		}
+		b.WriteByte(c)
+	}
+}
+
+// trimBOM retire l'éventuel BOM UTF-8 au début du flux.
+func (d *Decoder) trimBOM(line string) string {
+	if !d.started {
+		d.started = true
+		return strings.TrimPrefix(line, "\ufeff")
+	}
+	return line
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,231 @@
+package sse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeEvent(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  string
+	}{
+		{Event{Data: "hello"}, "data: hello\n\n"},
+		{Event{Data: ""}, "data: \n\n"},
+		{Event{ID: "7", Type: "order", Data: "a"}, "id: 7\nevent: order\ndata: a\n\n"},
+		{Event{Data: "{\n  \"a\": 1\n}"}, "data: {\ndata:   \"a\": 1\ndata: }\n\n"},
+		{Event{Data: "a\r\nb\rc\n"}, "data: a\ndata: b\ndata: c\ndata: \n\n"},
+		{Event{ID: "1\n2", Type: "x\r\ny", Data: "d"}, "id: 12\nevent: xy\ndata: d\n\n"},
+		{Event{Data: "r", Retry: 2 * time.Second}, "retry: 2000\ndata: r\n\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		encodeEvent(&b, &tt.event)
+		if b.String() != tt.want {
+			t.Errorf("encodeEvent(%+v) = %q, want %q", tt.event, b.String(), tt.want)
+		}
+	}
+
+	var b bytes.Buffer
+	encodeComment(&b, "one\ntwo")
+	if want := ": one\n: two\n\n"; b.String() != want {
+		t.Errorf("encodeComment = %q, want %q", b.String(), want)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	input := "\ufeff: comment\n" +
+		"retry: 2500\n\n" +
+		"data: first\n\n" +
+		"id: 42\r\nevent: order\r\ndata:no space\r\ndata:  two spaces\r\n\r\n" +
+		"event: ignored\n\n" +
+		"data\rfield-only\r\r" +
+		"retry: 1x\nid: bad\x00id\ndata: last\n\n" +
+		"data: incomplete\n"
+	d := NewDecoder(strings.NewReader(input))
+
+	want := []Event{
+		{Data: "first"},
+		{ID: "42", Type: "order", Data: "no space\n two spaces"},
+		{ID: "42", Data: ""},
+		{ID: "42", Data: "last"},
+	}
+	for _, w := range want {
+		e, err := d.Decode()
+		if err != nil {
+			t.Fatalf("Decode: %v, want %+v", err, w)
+		}
+		if *e != w {
+			t.Errorf("Decode = %+v, want %+v", *e, w)
+		}
+	}
+	if _, err := d.Decode(); err != io.EOF {
+		t.Errorf("Decode at end of stream = %v, want io.EOF", err)
+	}
+	if d.Retry() != 2500*time.Millisecond {
+		t.Errorf("Retry = %v, want 2.5s", d.Retry())
+	}
+	if d.LastEventID() != "42" {
+		t.Errorf("LastEventID = %q, want 42", d.LastEventID())
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	events := []Event{
+		{Data: "plain"},
+		{ID: "1", Type: "json", Data: "{\n  \"pretty\": true\n}"},
+		{ID: "2", Data: ":not a comment\n\nblank lines\n"},
+		{ID: "3", Type: "t", Data: " leading space"},
+		{ID: "3", Data: "slower", Retry: 5 * time.Second},
+	}
+	var b bytes.Buffer
+	encodeRetry(&b, 3*time.Second)
+	for i := range events {
+		encodeComment(&b, "ping")
+		encodeEvent(&b, &events[i])
+	}
+
+	d := NewDecoder(&b)
+	for _, want := range events {
+		got, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != want {
+			t.Errorf("round trip: got %+v, want %+v", *got, want)
+		}
+	}
+	if d.Retry() != 5*time.Second {
+		t.Errorf("Retry = %v, want the last one sent, 5s", d.Retry())
+	}
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add("1", "message", "hello")
+	f.Add("", "", "")
+	f.Add("a\nb", "x\r", "line\r\nline\rline\n")
+	f.Add("\x00", ":", ": comment\n\ndata: injected")
+	f.Fuzz(func(t *testing.T, id, typ, data string) {
+		var b bytes.Buffer
+		in := Event{ID: id, Type: typ, Data: data}
+		encodeEvent(&b, &in)
+
+		got, err := NewDecoder(&b).Decode()
+		if err != nil {
+			t.Fatalf("Decode(%q): %v", b.String(), err)
+		}
+		want := Event{
+			ID:   singleLine.Replace(id),
+			Type: singleLine.Replace(typ),
+			Data: newlines.Replace(data),
+		}
+		if *got != want {
+			t.Errorf("round trip of %+v: got %+v, want %+v", in, *got, want)
+		}
+	})
+}
+
+func TestConnFraming(t *testing.T) {
+	hub := New()
+	srv := newTestServer(t, hub)
+	lines := stream(t, srv.URL+"/events?id=alice", "", "")
+	waitFor(t, func() bool { return hub.Len() == 1 })
+
+	expect(t, lines, "retry: 3000")
+	expect(t, lines, "")
+	hub.Broadcast(NewEvent("", "a\nb"))
+	hub.Broadcast(NewEvent("", "c"))
+	for _, want := range []string{"id: 1", "data: a", "data: b", "", "id: 2", "data: c", ""} {
+		expect(t, lines, want)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                    false,
+		"gzip":                true,
+		"deflate, gzip;q=0.5": true,
+		"GZIP":                true,
+		"br":                  false,
+		"*":                   true,
+		"gzip;q=0, *":         false,
+		"identity, *;q=0":     false,
+	}
+	for header, want := range tests {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestCompressedStream(t *testing.T) {
+	hub := New()
+	srv := newTestServerWith(t, hub, func(conf *ClientConfig) {
+		conf.CompressionEnabled = true
+	})
+	// A transport that does not decompress, to read the stream as sent
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	get := func(id, acceptEncoding string) *http.Response {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/events?id="+id, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	gz := get("gz", "gzip")
+	plain := get("plain", "")
+	waitFor(t, func() bool { return hub.Len() == 2 })
+	if got := gz.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := plain.Header.Get("Content-Encoding"); got != "" {
+		t.Fatalf("Content-Encoding without Accept-Encoding = %q", got)
+	}
+
+	hub.Broadcast(NewEvent("", "first"))
+	hub.Broadcast(NewEvent("", "second"))
+
+	// Each event must be readable as soon as it is sent
+	zr, err := gzip.NewReader(gz.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, resp := range []io.Reader{zr, plain.Body} {
+		d := NewDecoder(resp)
+		for _, want := range []string{"first", "second"} {
+			e, err := d.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Data != want {
+				t.Errorf("Data = %q, want %q", e.Data, want)
+			}
+		}
+	}
+
+	// Closing terminates the gzip stream cleanly
+	conn, _ := hub.Get("gz")
+	conn.Close()
+	rest, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading the end of the gzip stream: %v", err)
+	}
+	if !strings.Contains(string(rest), "Server closing connection") {
+		t.Errorf("missing close event in %q", rest)
+	}
+}
@@ -0,0 +1,168 @@
+package sse
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	// ErrClosed est retourné par les envois sur une connexion fermée.
+	ErrClosed = errors.New("sse: connection is closed")
+	// ErrQueueFull est retourné quand un événement est refusé parce que la
+	// file de la connexion est pleine.
+	ErrQueueFull = errors.New("sse: queue full")
+)
+
+// OverflowPolicy décide quoi faire d'un événement quand la file d'envoi
+// d'une connexion est pleine, c'est-à-dire quand le client lit trop lentement.
+type OverflowPolicy int
+
+const (
+	// DropOldest retire l'événement le plus ancien de la file pour faire
+	// de la place. C'est la politique par défaut.
+	DropOldest OverflowPolicy = iota
+	// DropNewest refuse le nouvel événement avec ErrQueueFull.
+	DropNewest
+	// Disconnect ferme la connexion sans vider la file : le client se
+	// reconnectera et pourra reprendre grâce à Last-Event-ID.
+	Disconnect
+)
+
+// ConnStats décrit l'état de la file d'envoi d'une connexion.
+type ConnStats struct {
+	Queued    int    // Événements en attente d'écriture
+	MaxQueued int    // Profondeur maximale atteinte par la file
+	Sent      uint64 // Événements écrits
+	Dropped   uint64 // Événements abandonnés à cause d'un débordement
+}
+
+// frame est un message déjà encodé en attente d'écriture. event n'est
+// renseigné que pour les événements, pas pour les commentaires.
+type frame struct {
+	data  []byte
+	event *Event
+}
+
+func eventFrame(e *Event) frame {
+	var b bytes.Buffer
+	encodeEvent(&b, e)
+	ev := *e
+	ev.conn = nil
+	return frame{data: b.Bytes(), event: &ev}
+}
+
+func commentFrame(text string) frame {
+	var b bytes.Buffer
+	encodeComment(&b, text)
+	return frame{data: b.Bytes()}
+}
+
+// enqueueLocked ajoute f à la file en appliquant la politique de
+// débordement, sauf si force est vrai. mu doit être verrouillé.
+func (c *Conn) enqueueLocked(f frame, force bool) error {
+	if c.closing || c.closed || c.abort {
+		return ErrClosed
+	}
+	if !force && len(c.queue) >= c.config.QueueSize {
+		switch c.config.Overflow {
+		case DropNewest:
+			c.stats.Dropped++
+			return ErrQueueFull
+		case Disconnect:
+			c.stats.Dropped += uint64(len(c.queue)) + 1
+			c.queue = nil
+			c.abort = true
+			c.signal()
+			return ErrQueueFull
+		default:
+			c.queue[0] = frame{}
+			c.queue = c.queue[1:]
+			c.stats.Dropped++
+		}
+	}
+	c.queue = append(c.queue, f)
+	if len(c.queue) > c.stats.MaxQueued {
+		c.stats.MaxQueued = len(c.queue)
+	}
+	c.signal()
+	return nil
+}
+
+// signal réveille le writer sans bloquer.
+func (c *Conn) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run est le seul goroutine qui écrit sur la réponse une fois la connexion
+// ouverte. Il vide la file jusqu'à la fermeture, le départ du client ou une
+// erreur d'écriture.
+func (c *Conn) run() {
+	defer c.finish()
+	for {
+		c.mu.Lock()
+		for len(c.queue) == 0 && !c.closing && !c.abort {
+			c.mu.Unlock()
+			select {
+			case <-c.wake:
+			case <-c.context.Done():
+				// Le client est parti : inutile de lui écrire
+				return
+			}
+			c.mu.Lock()
+		}
+		if c.abort || len(c.queue) == 0 {
+			// Débordement, ou Close() et la file est vide
+			c.mu.Unlock()
+			return
+		}
+		f := c.queue[0]
+		c.queue[0] = frame{}
+		c.queue = c.queue[1:]
+		c.mu.Unlock()
+
+		if err := c.write(f.data); err != nil {
+			return
+		}
+		if f.event == nil {
+			continue
+		}
+		c.mu.Lock()
+		c.lastSent = time.Now()
+		c.stats.Sent++
+		c.mu.Unlock()
+
+		// Logging si activé
+		if c.config.LoggingEnabled {
+			log.Printf("Sent SSE event: %s, Data: %s", f.event.Type, f.event.Data)
+		}
+	}
+}
+
+// finish termine le flux gzip puis signale la fermeture. Le handler qui
+// attend Done peut alors retourner sans course avec le writer.
+func (c *Conn) finish() {
+	if c.gz != nil {
+		if c.gz.Close() == nil {
+			c.rc.Flush()
+		}
+	}
+	c.mu.Lock()
+	c.closed = true
+	c.queue = nil
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// Stats retourne l'état de la file d'envoi.
+func (c *Conn) Stats() ConnStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Queued = len(c.queue)
+	return s
+}
@@ -0,0 +1,88 @@
+package sse
+
+import (
+	"strconv"
+	"sync"
+)
+
+// Record est un événement conservé par un ReplayLog avec son numéro de
+// séquence, qui sert aussi d'ID à l'événement.
+type Record struct {
+	Seq   uint64
+	Event Event
+}
+
+// ReplayLog conserve les derniers événements publiés afin de les renvoyer aux
+// clients qui se reconnectent. Le sujet "" contient les événements envoyés
+// par Broadcast. Les implémentations doivent supporter l'accès concurrent.
+type ReplayLog interface {
+	// Append ajoute e sous topic et retourne son numéro de séquence. Les
+	// numéros croissent strictement, tous sujets confondus ; un journal
+	// persistant doit continuer sa numérotation après un redémarrage pour
+	// que les clients puissent reprendre là où ils étaient.
+	Append(topic string, e Event) uint64
+	// Since retourne, dans l'ordre, les événements de topic postérieurs à seq.
+	Since(topic string, seq uint64) []Record
+}
+
+// MemoryReplay garde en mémoire les size derniers événements de chaque sujet.
+type MemoryReplay struct {
+	mu     sync.Mutex
+	size   int
+	seq    uint64
+	topics map[string]*ring
+}
+
+// ring est un tampon circulaire de records.
+type ring struct {
+	records []Record
+	next    int
+	full    bool
+}
+
+func NewMemoryReplay(size int) *MemoryReplay {
+	if size <= 0 {
+		size = 100
+	}
+	return &MemoryReplay{size: size, topics: make(map[string]*ring)}
+}
+
+func (m *MemoryReplay) Append(topic string, e Event) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seq++
+	r, ok := m.topics[topic]
+	if !ok {
+		r = &ring{records: make([]Record, m.size)}
+		m.topics[topic] = r
+	}
+	e.conn = nil
+	e.ID = strconv.FormatUint(m.seq, 10)
+	r.records[r.next] = Record{Seq: m.seq, Event: e}
+	r.next = (r.next + 1) % len(r.records)
+	if r.next == 0 {
+		r.full = true
+	}
+	return m.seq
+}
+
+func (m *MemoryReplay) Since(topic string, seq uint64) []Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.topics[topic]
+	if !ok {
+		return nil
+	}
+	start, n := 0, r.next
+	if r.full {
+		start, n = r.next, len(r.records)
+	}
+	var out []Record
+	for i := 0; i < n; i++ {
+		rec := r.records[(start+i)%len(r.records)]
+		if rec.Seq > seq {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
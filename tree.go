@@ -0,0 +1,177 @@
+package octopus
+
+import (
+	"fmt"
+	"strings"
+)
+
+type nodeKind uint8
+
+const (
+	staticNode nodeKind = iota
+	paramNode
+	catchAllNode
+)
+
+// node is a vertex of the radix tree backing routes. Static nodes hold a
+// compressed prefix; param and catch-all nodes consume path text at match
+// time and are kept apart from the static children so lookups can try them
+// in priority order: static, then param, then catch-all.
+type node struct {
+	kind     nodeKind
+	prefix   string
+	indices  string // first byte of each static child, in order
+	children []*node
+	param    *node
+	catchAll *node
+	route    *route
+}
+
+// insert adds the concrete pattern path below n and returns the node where
+// it terminates.
+func (n *node) insert(path string) *node {
+	for len(path) > 0 {
+		switch path[0] {
+		case ':':
+			end := strings.IndexByte(path, '/')
+			if end < 0 {
+				end = len(path)
+			}
+			if n.param == nil {
+				n.param = &node{kind: paramNode}
+			}
+			n, path = n.param, path[end:]
+		case '*':
+			if n.catchAll == nil {
+				n.catchAll = &node{kind: catchAllNode}
+			}
+			return n.catchAll
+		default:
+			n, path = n.insertStatic(path)
+		}
+	}
+	return n
+}
+
+// insertStatic descends into (or creates) the static child sharing a prefix
+// with path, splitting it when only part of its prefix matches, and returns
+// that child along with the remainder of path.
+func (n *node) insertStatic(path string) (*node, string) {
+	end := strings.IndexAny(path, ":*")
+	if end < 0 {
+		end = len(path)
+	}
+
+	i := strings.IndexByte(n.indices, path[0])
+	if i < 0 {
+		child := &node{kind: staticNode, prefix: path[:end]}
+		n.indices += path[:1]
+		n.children = append(n.children, child)
+		return child, path[end:]
+	}
+
+	child := n.children[i]
+	l := commonPrefix(child.prefix, path[:end])
+	if l < len(child.prefix) {
+		split := &node{
+			kind:     staticNode,
+			prefix:   child.prefix[l:],
+			indices:  child.indices,
+			children: child.children,
+			param:    child.param,
+			catchAll: child.catchAll,
+			route:    child.route,
+		}
+		*child = node{
+			kind:     staticNode,
+			prefix:   child.prefix[:l],
+			indices:  split.prefix[:1],
+			children: []*node{split},
+		}
+	}
+	return child, path[l:]
+}
+
+// lookup walks the tree for path, appending captured parameter values to ps.
+// Their keys are filled in by routes.match once the route is known.
+// It backtracks when a higher priority branch dead-ends, so "/a/:id/x" still
+// matches "/a/b/x" when a static "/a/b" route exists.
+func (n *node) lookup(path string, ps []param) (*route, []param) {
+	switch n.kind {
+	case staticNode:
+		if !strings.HasPrefix(path, n.prefix) {
+			return nil, ps
+		}
+		path = path[len(n.prefix):]
+	case paramNode:
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end == 0 {
+			return nil, ps
+		}
+		ps = append(ps, param{value: path[:end]})
+		path = path[end:]
+	case catchAllNode:
+		return n.route, append(ps, param{value: path})
+	}
+
+	if path == "" && n.route != nil {
+		return n.route, ps
+	}
+
+	mark := len(ps)
+	if path != "" {
+		if i := strings.IndexByte(n.indices, path[0]); i >= 0 {
+			if r, values := n.children[i].lookup(path, ps); r != nil {
+				return r, values
+			}
+		}
+		if n.param != nil {
+			if r, values := n.param.lookup(path, ps[:mark]); r != nil {
+				return r, values
+			}
+		}
+	}
+	if n.catchAll != nil && n.catchAll.route != nil {
+		return n.catchAll.lookup(path, ps[:mark])
+	}
+	return nil, ps[:mark]
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// paramNames returns the names of the parameters captured by segs, in the
+// order lookup collects their values.
+func paramNames(segs []segment) []string {
+	var names []string
+	for _, s := range segs {
+		if s.kind != staticSegment {
+			names = append(names, s.value)
+		}
+	}
+	return names
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func conflictError(path, existing string) error {
+	return fmt.Errorf("octopus: route %q conflicts with %q: parameters must use the same names", path, existing)
+}
@@ -0,0 +1,154 @@
+package octopus
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// registration is returned by the route registration methods so that the
+// route can be named.
+type registration struct {
+	a       *App
+	pattern string
+}
+
+// Name names the route so that App.URL, and the url function of templates
+// rendered with Ctx.Render, can build its path. It panics if name is already
+// used by another route.
+func (r *registration) Name(name string) *registration {
+	r.a.Lock()
+	defer r.a.Unlock()
+	if existing, ok := r.a.names[name]; ok && existing != r.pattern {
+		panic(fmt.Sprintf("octopus: route name %q is already used by %q", name, existing))
+	}
+	r.a.names[name] = r.pattern
+	return r
+}
+
+// URL returns the path of the route registered under name, by a or by an
+// App mounted in it, including the prefixes of the Mount calls. params are
+// key/value pairs: keys naming a parameter of the route fill it in, escaped,
+// and the others make up the query string. Leaving out a required parameter,
+// or passing it nil, is an error; optional ones are dropped from the path.
+// Only catch-alls may contain "/": the router would not match a ":param"
+// holding one, so URL returns an error instead.
+//
+//	app.Get("/users/:id/:tab?", show).Name("user.show")
+//	app.URL("user.show", "id", 42, "page", 2) // "/users/42?page=2"
+func (a *App) URL(name string, params ...interface{}) (string, error) {
+	owner, pattern, ok := a.named(name)
+	if !ok {
+		return "", fmt.Errorf("octopus: no route named %q", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("octopus: url %q: odd number of parameters", name)
+	}
+	values := make(map[string]string, len(params)/2)
+	var keys []string
+	for i := 0; i < len(params); i += 2 {
+		key, ok := params[i].(string)
+		if !ok {
+			return "", fmt.Errorf("octopus: url %q: parameter name %v is not a string", name, params[i])
+		}
+		if params[i+1] == nil {
+			continue
+		}
+		if _, dup := values[key]; !dup {
+			keys = append(keys, key)
+		}
+		values[key] = fmt.Sprint(params[i+1])
+	}
+
+	// Among the variants of optional parameters, the one filling the most
+	// parameters wins. The last variant only has the required ones.
+	var (
+		best    []segment
+		most    = -1
+		missing string
+	)
+	for _, p := range expandPattern(pattern) {
+		segs := parsePattern(p)
+		n, complete := 0, true
+		for _, s := range segs {
+			if s.kind == staticSegment {
+				continue
+			}
+			if values[s.value] == "" {
+				complete, missing = false, s.value
+				break
+			}
+			n++
+		}
+		if complete && n > most {
+			best, most = segs, n
+		}
+	}
+	if most < 0 {
+		return "", fmt.Errorf("octopus: url %q: missing parameter %q for %s", name, missing, pattern)
+	}
+
+	var b strings.Builder
+	b.WriteString(owner.mountPath())
+	used := make(map[string]bool, most)
+	for _, s := range best {
+		switch s.kind {
+		case staticSegment:
+			b.WriteString(s.value)
+		case paramSegment:
+			if strings.Contains(values[s.value], "/") {
+				return "", fmt.Errorf("octopus: url %q: parameter %q cannot contain \"/\"", name, s.value)
+			}
+			b.WriteString(url.PathEscape(values[s.value]))
+			used[s.value] = true
+		case catchAllSegment:
+			parts := strings.Split(values[s.value], "/")
+			for i, part := range parts {
+				parts[i] = url.PathEscape(part)
+			}
+			b.WriteString(strings.Join(parts, "/"))
+			used[s.value] = true
+		}
+	}
+	query := url.Values{}
+	for _, key := range keys {
+		if !used[key] {
+			query.Set(key, values[key])
+		}
+	}
+	if len(query) > 0 {
+		b.WriteString("?")
+		b.WriteString(query.Encode())
+	}
+	return b.String(), nil
+}
+
+// named returns the pattern registered under name by a or, failing that, by
+// one of the Apps mounted in it, along with the App that registered it.
+func (a *App) named(name string) (*App, string, bool) {
+	a.RLock()
+	pattern, ok := a.names[name]
+	subApps := a.subApps
+	a.RUnlock()
+	if ok {
+		return a, pattern, true
+	}
+	for _, r := range subApps {
+		if owner, pattern, ok := r.a.named(name); ok {
+			return owner, pattern, true
+		}
+	}
+	return nil, "", false
+}
+
+// mountPath returns the path a is served under once mounted, through every
+// parent App, or "" if a is not mounted.
+func (a *App) mountPath() string {
+	a.RLock()
+	parent, prefix := a.mountedIn, a.mountPrefix
+	a.RUnlock()
+	if parent == nil {
+		return ""
+	}
+	return parent.mountPath() + prefix
+}
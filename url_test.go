@@ -0,0 +1,150 @@
+package octopus
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	app := New()
+	noop := func(c *Ctx) error { return nil }
+	app.Get("/", noop).Name("home")
+	app.Get("/users/:id/:tab?", noop).Name("user.show")
+	app.Get("/files/*path", noop).Name("files")
+	admin := app.Group("/admin")
+	admin.Post("/users/:id/ban", noop).Name("admin.ban")
+
+	tests := []struct {
+		name   string
+		params []interface{}
+		want   string
+		err    string
+	}{
+		{"home", nil, "/", ""},
+		{"home", []interface{}{"q", "a b", "page", 2}, "/?page=2&q=a+b", ""},
+		{"user.show", []interface{}{"id", 42}, "/users/42", ""},
+		{"user.show", []interface{}{"id", "a b", "tab", "posts"}, "/users/a%20b/posts", ""},
+		{"user.show", []interface{}{"id", "a/b"}, "", `parameter "id" cannot contain "/"`},
+		{"user.show", []interface{}{"tab", "posts"}, "", `missing parameter "id"`},
+		{"files", []interface{}{"path", "css/a b.css"}, "/files/css/a%20b.css", ""},
+		{"admin.ban", []interface{}{"id", 7, "reason", "spam"}, "/admin/users/7/ban?reason=spam", ""},
+		{"admin.ban", []interface{}{"id"}, "", "odd number"},
+		{"nope", nil, "", "no route"},
+	}
+	for _, tt := range tests {
+		got, err := app.URL(tt.name, tt.params...)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("URL(%q, %v) error = %v, want %q", tt.name, tt.params, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("URL(%q, %v) = %q, %v, want %q", tt.name, tt.params, got, err, tt.want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("reusing a route name did not panic")
+		}
+	}()
+	app.Get("/other", noop).Name("home")
+}
+
+func TestURLRoundTrip(t *testing.T) {
+	app := New()
+	echo := func(c *Ctx) error {
+		return c.WriteString(c.Param("id") + "|" + c.Param("tab") + "|" + c.Param("path"))
+	}
+	app.Get("/users/:id/:tab?", echo).Name("user.show")
+	app.Get("/files/*path", echo).Name("files")
+
+	tests := []struct {
+		name   string
+		params []interface{}
+		want   string
+	}{
+		{"user.show", []interface{}{"id", "a b", "tab", "50%?#"}, "a b|50%?#|"},
+		{"user.show", []interface{}{"id", "é"}, "é||"},
+		{"files", []interface{}{"path", "css/a b/%.css"}, "||css/a b/%.css"},
+	}
+	for _, tt := range tests {
+		u, err := app.URL(tt.name, tt.params...)
+		if err != nil {
+			t.Fatalf("URL(%q, %v): %v", tt.name, tt.params, err)
+		}
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, httptest.NewRequest("GET", u, nil))
+		if rr.Code != 200 || rr.Body.String() != tt.want {
+			t.Errorf("GET %s: got %d %q, want %q", u, rr.Code, rr.Body, tt.want)
+		}
+	}
+}
+
+func TestRenderURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "page.html")
+	os.WriteFile(path, []byte(`<a href="{{url "user.show" "id" .ID}}">me</a>`), 0o644)
+
+	app := New()
+	app.Get("/users/:id", func(c *Ctx) error { return nil }).Name("user.show")
+	app.Get("/page", func(c *Ctx) error { return c.Render(path, Map{"ID": 7}) })
+	app.Get("/broken", func(c *Ctx) error { return c.Render(path, Map{}) })
+
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, httptest.NewRequest("GET", "/page", nil))
+	if got := rr.Body.String(); got != `<a href="/users/7">me</a>` {
+		t.Errorf("body %q", got)
+	}
+	rr = httptest.NewRecorder()
+	app.ServeHTTP(rr, httptest.NewRequest("GET", "/broken", nil))
+	if rr.Code != 500 {
+		t.Errorf("rendering without the id: status %d, want 500", rr.Code)
+	}
+}
+
+func TestURLMount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "page.html")
+	os.WriteFile(path, []byte(`{{url "invoice" "id" .ID}}`), 0o644)
+
+	noop := func(c *Ctx) error { return nil }
+	api := New()
+	api.Get("/status", noop).Name("api.status")
+	billing := New()
+	billing.Get("/invoices/:id", noop).Name("invoice")
+	billing.Get("/page", func(c *Ctx) error { return c.Render(path, Map{"ID": 7}) })
+	billing.Mount("/api", api)
+	app := New()
+	app.Get("/", noop).Name("home")
+	app.Mount("/billing/", billing)
+
+	tests := []struct {
+		app    *App
+		name   string
+		params []interface{}
+		want   string
+	}{
+		{billing, "invoice", []interface{}{"id", 1}, "/billing/invoices/1"},
+		{app, "invoice", []interface{}{"id", 1, "paid", true}, "/billing/invoices/1?paid=true"},
+		{app, "api.status", nil, "/billing/api/status"},
+		{api, "api.status", nil, "/billing/api/status"},
+		{app, "home", nil, "/"},
+	}
+	for _, tt := range tests {
+		if got, err := tt.app.URL(tt.name, tt.params...); err != nil || got != tt.want {
+			t.Errorf("URL(%q, %v) = %q, %v, want %q", tt.name, tt.params, got, err, tt.want)
+		}
+	}
+	if _, err := billing.URL("home"); err == nil {
+		t.Error("a mounted App resolved a name of its parent")
+	}
+
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, httptest.NewRequest("GET", "/billing/page", nil))
+	if got := rr.Body.String(); got != "/billing/invoices/7" {
+		t.Errorf("url in a template of the mounted App: %q", got)
+	}
+}
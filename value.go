@@ -44,3 +44,19 @@ func (v *value) Delete(key interface{}) {
 	defer v.Unlock()
 	delete(v.data, key)
 }
+
+// reset removes every value, keeping the map for reuse.
+func (v *value) reset() {
+	v.Lock()
+	defer v.Unlock()
+	clear(v.data)
+}
+
+// inherit copies the values of from.
+func (v *value) inherit(from *value) {
+	from.RLock()
+	defer from.RUnlock()
+	for key, val := range from.data {
+		v.Set(key, val)
+	}
+}
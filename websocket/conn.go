@@ -0,0 +1,438 @@
+package websocket
+
+import (
+	"bufio"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrCloseSent est retourné par les écritures après l'envoi de la trame de
+// fermeture.
+var ErrCloseSent = errors.New("websocket: close sent")
+
+// Config configure une connexion WebSocket. Le zéro est utilisable.
+type Config struct {
+	// ID identifie la connexion dans un Hub. Par défaut un UUID.
+	ID string
+
+	// Subprotocols liste, par ordre de préférence, les sous-protocoles
+	// acceptés. Le premier proposé par le client est retenu.
+	Subprotocols []string
+
+	// CheckOrigin décide si la requête est acceptée selon son en-tête Origin.
+	// Par défaut, seule une origine de même hôte (ou son absence) l'est.
+	CheckOrigin func(origin, host string) bool
+
+	// EnableCompression négocie permessage-deflate quand le client le propose.
+	EnableCompression bool
+	// CompressionLevel est le niveau de compress/flate. Par défaut BestSpeed.
+	CompressionLevel int
+
+	// ReadLimit est la taille maximale d'un message reçu, décompressé. Par
+	// défaut 32 Mo ; au-delà la connexion est fermée avec 1009.
+	ReadLimit int64
+	// FragmentSize découpe les messages envoyés en trames de cette taille.
+	// 0 envoie chaque message en une seule trame.
+	FragmentSize int
+
+	// WriteTimeout borne chaque écriture. Par défaut 10 secondes.
+	WriteTimeout time.Duration
+	// PingInterval envoie un ping à cet intervalle ; la connexion est alors
+	// fermée si rien n'est reçu pendant deux intervalles. 0 le désactive.
+	PingInterval time.Duration
+	// CloseTimeout est le temps laissé au pair pour répondre à la trame de
+	// fermeture. Par défaut 5 secondes.
+	CloseTimeout time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.CheckOrigin == nil {
+		c.CheckOrigin = sameHost
+	}
+	if c.CompressionLevel == 0 {
+		c.CompressionLevel = flate.BestSpeed
+	}
+	if c.ReadLimit <= 0 {
+		c.ReadLimit = 32 << 20
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = 10 * time.Second
+	}
+	if c.CloseTimeout <= 0 {
+		c.CloseTimeout = 5 * time.Second
+	}
+	return c
+}
+
+// Conn est une connexion WebSocket. Un seul goroutine peut lire à la fois ;
+// les écritures peuvent être concurrentes.
+type Conn struct {
+	id          string
+	conn        net.Conn
+	br          *bufio.Reader
+	server      bool
+	subprotocol string
+	compress    bool
+	config      Config
+	appDone     <-chan struct{}
+
+	wmu sync.Mutex // Sérialise les trames envoyées
+
+	mu        sync.Mutex // Protège closeSent, closed et onPong
+	closeSent bool
+	closed    bool
+	done      chan struct{}
+	onPong    func(data []byte)
+
+	readErr error // Première erreur de lecture, définitive
+}
+
+func newConn(nc net.Conn, br *bufio.Reader, server bool, subprotocol string, compress bool, config Config, appDone <-chan struct{}) *Conn {
+	c := &Conn{
+		id:          config.ID,
+		conn:        nc,
+		br:          br,
+		server:      server,
+		subprotocol: subprotocol,
+		compress:    compress,
+		config:      config,
+		appDone:     appDone,
+		done:        make(chan struct{}),
+	}
+	c.extendReadDeadline()
+	go c.watch()
+	return c
+}
+
+func (c *Conn) ID() string {
+	return c.id
+}
+
+// Subprotocol retourne le sous-protocole négocié, ou une chaîne vide.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// Compressed indique si permessage-deflate a été négocié.
+func (c *Conn) Compressed() bool {
+	return c.compress
+}
+
+// Done retourne un canal fermé quand la connexion TCP est fermée.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// SetPongHandler définit la fonction appelée, pendant ReadMessage, à chaque
+// pong reçu.
+func (c *Conn) SetPongHandler(f func(data []byte)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onPong = f
+}
+
+// watch envoie les pings et ferme la connexion quand l'App s'arrête.
+func (c *Conn) watch() {
+	var ping <-chan time.Time
+	if c.config.PingInterval > 0 {
+		ticker := time.NewTicker(c.config.PingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.appDone:
+			c.CloseWithCode(CloseGoingAway, "server shutting down")
+			return
+		case <-ping:
+			if err := c.Ping(nil); err != nil && !errors.Is(err, ErrCloseSent) {
+				c.closeNet()
+				return
+			}
+		}
+	}
+}
+
+func (c *Conn) extendReadDeadline() {
+	if c.config.PingInterval > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(2 * c.config.PingInterval))
+	}
+}
+
+// ReadMessage lit le prochain message de données, en répondant aux pings et
+// en réassemblant les fragments. Une fois la connexion fermée, il retourne
+// une *CloseError : celle du pair, ou 1006 si la connexion a été coupée.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	t, data, err := c.readMessage()
+	if err != nil {
+		c.readErr = c.fail(err)
+		return 0, nil, c.readErr
+	}
+	return t, data, nil
+}
+
+// ReadJSON lit un message et le décode dans v.
+func (c *Conn) ReadJSON(v interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (c *Conn) readMessage() (MessageType, []byte, error) {
+	var (
+		opcode     byte
+		compressed bool
+		message    []byte
+	)
+	for {
+		h, err := readHeader(c.br)
+		if err != nil {
+			return 0, nil, err
+		}
+		if h.masked != c.server {
+			// Le client masque toujours, le serveur jamais (section 5.1)
+			return 0, nil, protocolError("invalid masking")
+		}
+		if h.rsv1 && (!c.compress || isControl(h.opcode) || h.opcode == opContinuation) {
+			return 0, nil, protocolError("unexpected RSV1")
+		}
+		if !isControl(h.opcode) && int64(len(message))+h.length > c.config.ReadLimit {
+			return 0, nil, &CloseError{Code: CloseMessageTooBig}
+		}
+
+		payload := make([]byte, h.length)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			return 0, nil, err
+		}
+		if h.masked {
+			maskBytes(h.mask[:], payload)
+		}
+		c.extendReadDeadline()
+
+		switch h.opcode {
+		case opPing:
+			if err := c.writeControl(opPong, payload); err != nil && !errors.Is(err, ErrCloseSent) {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			c.mu.Lock()
+			onPong := c.onPong
+			c.mu.Unlock()
+			if onPong != nil {
+				onPong(payload)
+			}
+			continue
+		case opClose:
+			ce, err := parseClosePayload(payload)
+			if err != nil {
+				return 0, nil, err
+			}
+			if !utf8.ValidString(ce.Reason) {
+				return 0, nil, &CloseError{Code: CloseInvalidFramePayloadData, Reason: "invalid close reason"}
+			}
+			// Le pair ferme : on lui répond avec le même code, sauf si c'est
+			// la réponse à notre propre trame de fermeture
+			code := ce.Code
+			if code == CloseNoStatusReceived {
+				code = CloseNormalClosure
+			}
+			c.sendClose(code, "")
+			c.closeNet()
+			return 0, nil, ce
+		case opText, opBinary:
+			if opcode != 0 {
+				return 0, nil, protocolError("expected a continuation frame")
+			}
+			opcode, compressed, message = h.opcode, h.rsv1, payload
+		case opContinuation:
+			if opcode == 0 {
+				return 0, nil, protocolError("unexpected continuation frame")
+			}
+			message = append(message, payload...)
+		}
+		if h.fin {
+			break
+		}
+	}
+
+	if compressed {
+		var err error
+		if message, err = decompressMessage(message, c.config.ReadLimit); err != nil {
+			return 0, nil, err
+		}
+	}
+	if opcode == opText && !utf8.Valid(message) {
+		return 0, nil, &CloseError{Code: CloseInvalidFramePayloadData, Reason: "invalid UTF-8"}
+	}
+	return MessageType(opcode), message, nil
+}
+
+// fail termine la connexion après une erreur de lecture et retourne l'erreur
+// à présenter à l'appelant.
+func (c *Conn) fail(err error) error {
+	var ce *CloseError
+	if !errors.As(err, &ce) {
+		// Connexion coupée sans trame de fermeture
+		c.closeNet()
+		return &CloseError{Code: CloseAbnormalClosure, Reason: err.Error()}
+	}
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if !closed {
+		// Erreur de protocole détectée localement
+		c.sendClose(ce.Code, ce.Reason)
+		c.closeNet()
+	}
+	return ce
+}
+
+// WriteMessage envoie un message de données, compressé si permessage-deflate
+// a été négocié et fragmenté selon Config.FragmentSize.
+func (c *Conn) WriteMessage(t MessageType, data []byte) error {
+	if t != TextMessage && t != BinaryMessage {
+		return errors.New("websocket: invalid message type")
+	}
+	compressed := false
+	if c.compress {
+		var err error
+		if data, err = compressMessage(data, c.config.CompressionLevel); err != nil {
+			return err
+		}
+		compressed = true
+	}
+
+	size := c.config.FragmentSize
+	if size <= 0 || size > len(data) {
+		size = len(data)
+	}
+	var frames []byte
+	opcode := byte(t)
+	for first := true; first || len(data) > 0; first = false {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+		frames = appendFrame(frames, n == len(data), compressed && first, opcode, c.newMask(), data[:n])
+		data = data[n:]
+		opcode = opContinuation
+	}
+	return c.write(frames, false)
+}
+
+// WriteText envoie un message texte.
+func (c *Conn) WriteText(s string) error {
+	return c.WriteMessage(TextMessage, []byte(s))
+}
+
+// WriteJSON envoie v encodé en JSON dans un message texte.
+func (c *Conn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(TextMessage, data)
+}
+
+// Ping envoie un ping ; la réponse est transmise au PongHandler.
+func (c *Conn) Ping(data []byte) error {
+	return c.writeControl(opPing, data)
+}
+
+func (c *Conn) writeControl(opcode byte, payload []byte) error {
+	if len(payload) > maxControlPayload {
+		return errors.New("websocket: control payload too large")
+	}
+	return c.write(appendFrame(nil, true, false, opcode, c.newMask(), payload), opcode == opClose)
+}
+
+// write envoie des trames déjà encodées. Seule la trame de fermeture peut
+// être écrite après que closeSent a été positionné.
+func (c *Conn) write(frames []byte, closing bool) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.mu.Lock()
+	closeSent := c.closeSent
+	c.mu.Unlock()
+	if closeSent && !closing {
+		return ErrCloseSent
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
+	_, err := c.conn.Write(frames)
+	return err
+}
+
+func (c *Conn) newMask() []byte {
+	if c.server {
+		return nil
+	}
+	mask := make([]byte, 4)
+	rand.Read(mask)
+	return mask
+}
+
+// sendClose envoie la trame de fermeture une seule fois.
+func (c *Conn) sendClose(code int, reason string) error {
+	payload := closePayload(code, reason)
+	frame := appendFrame(nil, true, false, opClose, c.newMask(), payload)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.mu.Lock()
+	if c.closeSent {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closeSent = true
+	c.mu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close ferme la connexion avec le code 1000.
+func (c *Conn) Close() error {
+	return c.CloseWithCode(CloseNormalClosure, "")
+}
+
+// CloseWithCode démarre la fermeture : la trame de fermeture est envoyée et
+// la connexion TCP est fermée quand le pair répond, pendant ReadMessage, ou
+// au plus tard après Config.CloseTimeout.
+func (c *Conn) CloseWithCode(code int, reason string) error {
+	err := c.sendClose(code, reason)
+	if err != nil {
+		c.closeNet()
+		return err
+	}
+	time.AfterFunc(c.config.CloseTimeout, c.closeNet)
+	return nil
+}
+
+// closeNet ferme la connexion TCP et Done.
+func (c *Conn) closeNet() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	close(c.done)
+	c.mu.Unlock()
+	c.conn.Close()
+}
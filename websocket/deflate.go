@@ -0,0 +1,79 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strings"
+)
+
+// Extension permessage-deflate (RFC 7692). Chaque message est compressé
+// indépendamment, sans reprise de contexte dans un sens ni dans l'autre, ce
+// qui est toujours négocié.
+const deflateResponse = "permessage-deflate; server_no_context_takeover; client_no_context_takeover"
+
+// deflateTail termine un bloc compressé vidé avec Flush ; il est retiré à
+// l'envoi et rajouté à la réception (section 7.2.1).
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+// deflateEnd est un bloc final vide qui évite io.ErrUnexpectedEOF.
+var deflateEnd = []byte{0x01, 0x00, 0x00, 0xff, 0xff}
+
+func compressMessage(data []byte, level int) ([]byte, error) {
+	var b bytes.Buffer
+	w, err := flate.NewWriter(&b, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), deflateTail), nil
+}
+
+// decompressMessage décompresse data en refusant plus de limit octets.
+func decompressMessage(data []byte, limit int64) ([]byte, error) {
+	r := flate.NewReader(io.MultiReader(bytes.NewReader(data), bytes.NewReader(deflateTail), bytes.NewReader(deflateEnd)))
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, &CloseError{Code: CloseInvalidFramePayloadData, Reason: "invalid compressed data"}
+	}
+	if int64(len(out)) > limit {
+		return nil, &CloseError{Code: CloseMessageTooBig}
+	}
+	return out, nil
+}
+
+// acceptDeflate retourne true si l'une des offres de l'en-tête
+// Sec-WebSocket-Extensions est une permessage-deflate que l'on sait honorer.
+func acceptDeflate(header string) bool {
+	for _, offer := range strings.Split(header, ",") {
+		params := strings.Split(offer, ";")
+		if strings.TrimSpace(params[0]) != "permessage-deflate" {
+			continue
+		}
+		ok := true
+		for _, p := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+			value = strings.Trim(strings.TrimSpace(value), `"`)
+			switch strings.TrimSpace(name) {
+			case "server_no_context_takeover", "client_no_context_takeover":
+			case "client_max_window_bits":
+				// Le décompresseur accepte toutes les tailles de fenêtre
+			case "server_max_window_bits":
+				// compress/flate utilise toujours une fenêtre de 32 Ko
+				ok = ok && value == "15"
+			default:
+				ok = false
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,235 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Opcodes des trames (RFC 6455, section 5.2).
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+const (
+	finBit  = 0x80
+	rsv1Bit = 0x40
+	rsv2Bit = 0x20
+	rsv3Bit = 0x10
+	maskBit = 0x80
+
+	// maxControlPayload est la taille maximale d'une trame de contrôle.
+	maxControlPayload = 125
+)
+
+// MessageType est le type d'un message de données.
+type MessageType int
+
+const (
+	TextMessage   MessageType = opText
+	BinaryMessage MessageType = opBinary
+)
+
+// Codes de fermeture (RFC 6455, section 7.4.1).
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+// CloseError est retourné par les lectures une fois la connexion fermée par
+// le pair ou à la suite d'une erreur de protocole.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket: close %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: close %d: %s", e.Code, e.Reason)
+}
+
+// IsCloseError indique si err est une CloseError avec l'un des codes donnés.
+func IsCloseError(err error, codes ...int) bool {
+	var ce *CloseError
+	if !errors.As(err, &ce) {
+		return false
+	}
+	for _, code := range codes {
+		if ce.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// validCloseCode indique si code peut apparaître dans une trame de fermeture.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// header est l'en-tête d'une trame.
+type header struct {
+	fin    bool
+	rsv1   bool
+	opcode byte
+	masked bool
+	mask   [4]byte
+	length int64
+}
+
+func isControl(opcode byte) bool {
+	return opcode&0x8 != 0
+}
+
+// readHeader lit l'en-tête d'une trame. Les bits RSV2 et RSV3 ne sont
+// utilisés par aucune extension prise en charge.
+func readHeader(r io.Reader) (header, error) {
+	var h header
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:2]); err != nil {
+		return h, err
+	}
+	h.fin = b[0]&finBit != 0
+	h.rsv1 = b[0]&rsv1Bit != 0
+	h.opcode = b[0] & 0x0F
+	h.masked = b[1]&maskBit != 0
+	if b[0]&(rsv2Bit|rsv3Bit) != 0 {
+		return h, protocolError("reserved bits set")
+	}
+
+	switch n := b[1] & 0x7F; n {
+	case 126:
+		if _, err := io.ReadFull(r, b[:2]); err != nil {
+			return h, err
+		}
+		h.length = int64(binary.BigEndian.Uint16(b[:2]))
+	case 127:
+		if _, err := io.ReadFull(r, b[:8]); err != nil {
+			return h, err
+		}
+		h.length = int64(binary.BigEndian.Uint64(b[:8]))
+		if h.length < 0 {
+			return h, protocolError("invalid payload length")
+		}
+	default:
+		h.length = int64(n)
+	}
+
+	if h.masked {
+		if _, err := io.ReadFull(r, h.mask[:]); err != nil {
+			return h, err
+		}
+	}
+
+	switch h.opcode {
+	case opContinuation, opText, opBinary:
+	case opClose, opPing, opPong:
+		if !h.fin {
+			return h, protocolError("fragmented control frame")
+		}
+		if h.length > maxControlPayload {
+			return h, protocolError("control frame too large")
+		}
+	default:
+		return h, protocolError(fmt.Sprintf("unknown opcode %#x", h.opcode))
+	}
+	return h, nil
+}
+
+// appendFrame ajoute à b une trame complète. Un client masque toujours ses
+// trames avec mask ; un serveur ne les masque jamais (mask nil).
+func appendFrame(b []byte, fin, rsv1 bool, opcode byte, mask []byte, payload []byte) []byte {
+	first := opcode
+	if fin {
+		first |= finBit
+	}
+	if rsv1 {
+		first |= rsv1Bit
+	}
+	b = append(b, first)
+
+	var second byte
+	if mask != nil {
+		second = maskBit
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		b = append(b, second|byte(n))
+	case n <= 0xFFFF:
+		b = append(b, second|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, second|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+
+	if mask == nil {
+		return append(b, payload...)
+	}
+	b = append(b, mask...)
+	start := len(b)
+	b = append(b, payload...)
+	maskBytes(mask, b[start:])
+	return b
+}
+
+// maskBytes applique (ou retire) le masque XOR de la section 5.3.
+func maskBytes(mask []byte, b []byte) {
+	for i := range b {
+		b[i] ^= mask[i&3]
+	}
+}
+
+// closePayload encode le corps d'une trame de fermeture.
+func closePayload(code int, reason string) []byte {
+	if code == CloseNoStatusReceived {
+		return nil
+	}
+	b := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if len(reason) > maxControlPayload-2 {
+		reason = reason[:maxControlPayload-2]
+	}
+	return append(b, reason...)
+}
+
+// parseClosePayload décode le corps d'une trame de fermeture.
+func parseClosePayload(p []byte) (*CloseError, error) {
+	switch {
+	case len(p) == 0:
+		return &CloseError{Code: CloseNoStatusReceived}, nil
+	case len(p) == 1:
+		return nil, protocolError("invalid close payload")
+	}
+	code := int(binary.BigEndian.Uint16(p))
+	if !validCloseCode(code) {
+		return nil, protocolError(fmt.Sprintf("invalid close code %d", code))
+	}
+	return &CloseError{Code: code, Reason: string(p[2:])}, nil
+}
+
+func protocolError(reason string) *CloseError {
+	return &CloseError{Code: CloseProtocolError, Reason: reason}
+}
@@ -0,0 +1,189 @@
+package websocket
+
+import (
+	"sync"
+
+	"github.com/abdotop/octopus"
+)
+
+// Hub suit les connexions ouvertes et leur envoie des messages, à toutes
+// (Broadcast) ou à celles d'un salon (Publish).
+type Hub struct {
+	sync.RWMutex
+	conns map[string]*Conn
+	rooms map[string]map[string]*Conn // salon -> id -> connexion
+	joins map[string]map[string]bool  // id -> salons
+}
+
+func New() *Hub {
+	return &Hub{
+		conns: make(map[string]*Conn),
+		rooms: make(map[string]map[string]*Conn),
+		joins: make(map[string]map[string]bool),
+	}
+}
+
+// Upgrade ouvre une connexion comme websocket.Upgrade et l'enregistre.
+func (h *Hub) Upgrade(c *octopus.Ctx, conf *Config) (*Conn, error) {
+	conn, err := Upgrade(c, conf)
+	if err != nil {
+		return nil, err
+	}
+	h.Add(conn)
+	return conn, nil
+}
+
+// Add inscrit une connexion déjà ouverte, par exemple avec websocket.Upgrade
+// et un Config personnalisé. Le hub l'oublie de lui-même quand elle se ferme,
+// à l'initiative du client ou du serveur.
+func (h *Hub) Add(conn *Conn) {
+	h.Lock()
+	h.conns[conn.id] = conn
+	h.Unlock()
+
+	go func() {
+		<-conn.Done()
+		h.remove(conn)
+	}()
+}
+
+// remove désinscrit conn et la fait quitter ses salons. Si un client s'est
+// reconnecté avec le même id avant la fermeture, la nouvelle connexion garde
+// sa place.
+func (h *Hub) remove(conn *Conn) {
+	h.Lock()
+	defer h.Unlock()
+	if h.conns[conn.id] != conn {
+		return
+	}
+	delete(h.conns, conn.id)
+	for room := range h.joins[conn.id] {
+		delete(h.rooms[room], conn.id)
+		if len(h.rooms[room]) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+	delete(h.joins, conn.id)
+}
+
+// Get cherche la connexion inscrite sous id, pour lui écrire directement
+// plutôt que par un salon.
+func (h *Hub) Get(id string) (*Conn, bool) {
+	h.RLock()
+	defer h.RUnlock()
+	conn, ok := h.conns[id]
+	return conn, ok
+}
+
+// Len compte les connexions inscrites qui ne sont pas encore fermées.
+func (h *Hub) Len() int {
+	h.RLock()
+	defer h.RUnlock()
+	return len(h.conns)
+}
+
+// Join fait entrer la connexion id dans les salons donnés. Il retourne
+// false si aucune connexion ouverte n'a cet id.
+func (h *Hub) Join(id string, rooms ...string) bool {
+	h.Lock()
+	defer h.Unlock()
+	conn, ok := h.conns[id]
+	if !ok {
+		return false
+	}
+	if h.joins[id] == nil {
+		h.joins[id] = make(map[string]bool)
+	}
+	for _, room := range rooms {
+		if h.rooms[room] == nil {
+			h.rooms[room] = make(map[string]*Conn)
+		}
+		h.rooms[room][id] = conn
+		h.joins[id][room] = true
+	}
+	return true
+}
+
+// Leave fait sortir la connexion id des salons donnés.
+func (h *Hub) Leave(id string, rooms ...string) {
+	h.Lock()
+	defer h.Unlock()
+	for _, room := range rooms {
+		delete(h.rooms[room], id)
+		if len(h.rooms[room]) == 0 {
+			delete(h.rooms, room)
+		}
+		delete(h.joins[id], room)
+	}
+}
+
+// Rooms retourne les salons de la connexion id.
+func (h *Hub) Rooms(id string) []string {
+	h.RLock()
+	defer h.RUnlock()
+	rooms := make([]string, 0, len(h.joins[id]))
+	for room := range h.joins[id] {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// Broadcast envoie un message à toutes les connexions ouvertes, sauf
+// celles dont l'id est dans except, et retourne le nombre de connexions qui
+// l'ont reçu.
+func (h *Hub) Broadcast(t MessageType, data []byte, except ...string) int {
+	h.RLock()
+	targets := make([]*Conn, 0, len(h.conns))
+	for _, conn := range h.conns {
+		targets = append(targets, conn)
+	}
+	h.RUnlock()
+	return deliver(targets, t, data, except)
+}
+
+// Publish envoie un message aux connexions du salon room, sauf celles dont
+// l'id est dans except, et retourne le nombre de connexions qui l'ont reçu.
+func (h *Hub) Publish(room string, t MessageType, data []byte, except ...string) int {
+	h.RLock()
+	targets := make([]*Conn, 0, len(h.rooms[room]))
+	for _, conn := range h.rooms[room] {
+		targets = append(targets, conn)
+	}
+	h.RUnlock()
+	return deliver(targets, t, data, except)
+}
+
+// deliver écrit en parallèle pour qu'un client lent ne retarde pas les
+// autres au-delà de son WriteTimeout.
+func deliver(targets []*Conn, t MessageType, data []byte, except []string) int {
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		n  int
+	)
+	for _, conn := range targets {
+		if contains(except, conn.id) {
+			continue
+		}
+		wg.Add(1)
+		go func(conn *Conn) {
+			defer wg.Done()
+			if conn.WriteMessage(t, data) == nil {
+				mu.Lock()
+				n++
+				mu.Unlock()
+			}
+		}(conn)
+	}
+	wg.Wait()
+	return n
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
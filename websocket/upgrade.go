@@ -0,0 +1,146 @@
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/abdotop/octopus"
+	"github.com/google/uuid"
+)
+
+// acceptGUID est concaténé à Sec-WebSocket-Key pour calculer
+// Sec-WebSocket-Accept (section 4.2.2).
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Upgrade termine la poignée de main WebSocket de la requête de c et prend
+// le contrôle de la connexion. En cas de refus, l'erreur retournée est une
+// *octopus.HTTPError que le handler peut retourner telle quelle.
+func Upgrade(c *octopus.Ctx, conf *Config) (*Conn, error) {
+	var config Config
+	if conf != nil {
+		config = *conf
+	}
+	config = config.withDefaults()
+	if config.ID == "" {
+		config.ID = uuid.NewString()
+	}
+
+	r, w := c.Request(), c.Response()
+	if r == nil {
+		return nil, fmt.Errorf("websocket: failed to get Request from context")
+	}
+	if w == nil {
+		return nil, fmt.Errorf("websocket: failed to get Writer from context")
+	}
+
+	if r.Method != http.MethodGet {
+		return nil, octopus.NewError(octopus.StatusMethodNotAllowed, "websocket: upgrade requires GET")
+	}
+	if !hasToken(r.Header, "Connection", "upgrade") || !hasToken(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		return nil, octopus.NewError(octopus.StatusUpgradeRequired, "websocket: not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, octopus.NewError(octopus.StatusUpgradeRequired, "websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, octopus.NewError(octopus.StatusBadRequest, "websocket: invalid Sec-WebSocket-Key")
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && !config.CheckOrigin(origin, r.Host) {
+		return nil, octopus.NewError(octopus.StatusForbidden, "websocket: origin not allowed")
+	}
+
+	subprotocol := selectSubprotocol(r.Header, config.Subprotocols)
+	compress := config.EnableCompression && acceptDeflate(strings.Join(r.Header.Values("Sec-WebSocket-Extensions"), ","))
+
+	// ResponseController retrouve le Hijacker derrière les writers qui
+	// exposent Unwrap
+	nc, brw, err := http.NewResponseController(w).Hijack()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil, fmt.Errorf("websocket: response does not support hijacking")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if brw.Reader.Buffered() > 0 {
+		// Le client ne doit rien envoyer avant la réponse
+		nc.Close()
+		return nil, fmt.Errorf("websocket: client sent data before the handshake completed")
+	}
+
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	b.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+	if subprotocol != "" {
+		b.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	if compress {
+		b.WriteString("Sec-WebSocket-Extensions: " + deflateResponse + "\r\n")
+	}
+	b.WriteString("\r\n")
+	nc.SetWriteDeadline(time.Now().Add(config.WriteTimeout))
+	if _, err := nc.Write([]byte(b.String())); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+
+	// Les connexions se ferment avec 1001 quand l'App s'arrête
+	var appDone <-chan struct{}
+	if app := c.App(); app != nil {
+		appDone = app.Done()
+	}
+	return newConn(nc, brw.Reader, true, subprotocol, compress, config, appDone), nil
+}
+
+// acceptKey calcule Sec-WebSocket-Accept.
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// hasToken indique si l'en-tête name contient token dans sa liste séparée
+// par des virgules.
+func hasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectSubprotocol retient le premier sous-protocole proposé par le client
+// que le serveur accepte.
+func selectSubprotocol(h http.Header, supported []string) string {
+	for _, v := range h.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(v, ",") {
+			p = strings.TrimSpace(p)
+			for _, s := range supported {
+				if p == s {
+					return p
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// sameHost accepte les origines dont l'hôte est celui de la requête.
+func sameHost(origin, host string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, host)
+}
@@ -0,0 +1,354 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abdotop/octopus"
+)
+
+// newServer serves handler on /ws and returns the server address.
+func newServer(t *testing.T, handler octopus.HandlerFunc) *httptest.Server {
+	t.Helper()
+	app := octopus.New()
+	app.Get("/ws", handler)
+	srv := httptest.NewServer(app)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// echo answers every message with itself until the connection closes.
+func echo(conf *Config) octopus.HandlerFunc {
+	return func(c *octopus.Ctx) error {
+		conn, err := Upgrade(c, conf)
+		if err != nil {
+			return err
+		}
+		for {
+			t, data, err := conn.ReadMessage()
+			if err != nil {
+				return nil
+			}
+			if err := conn.WriteMessage(t, data); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// dial performs a client handshake by hand against /ws on addr and returns
+// a client-side Conn.
+func dial(t *testing.T, addr, query string, header http.Header) (*Conn, *http.Response) {
+	t.Helper()
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "http://"+addr+"/ws"+query, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err := req.Write(nc); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(nc)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		nc.Close()
+		return nil, resp
+	}
+	compress := strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+	conn := newConn(nc, br, false, resp.Header.Get("Sec-WebSocket-Protocol"), compress, Config{CloseTimeout: time.Second}.withDefaults(), nil)
+	t.Cleanup(conn.closeNet)
+	return conn, resp
+}
+
+func TestHandshake(t *testing.T) {
+	srv := newServer(t, echo(&Config{Subprotocols: []string{"chat", "v2"}}))
+
+	conn, resp := dial(t, srv.Listener.Addr().String(), "", http.Header{"Sec-Websocket-Protocol": {"v1, v2"}})
+	if conn == nil {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	// Example from RFC 6455, section 1.3
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept = %q", got)
+	}
+	if conn.Subprotocol() != "v2" {
+		t.Errorf("Subprotocol = %q, want v2", conn.Subprotocol())
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		code   int
+	}{
+		{"no upgrade", http.Header{"Upgrade": {"h2c"}}, http.StatusUpgradeRequired},
+		{"version", http.Header{"Sec-Websocket-Version": {"8"}}, http.StatusUpgradeRequired},
+		{"key", http.Header{"Sec-Websocket-Key": {"short"}}, http.StatusBadRequest},
+		{"origin", http.Header{"Origin": {"https://evil.example"}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		conn, resp := dial(t, srv.Listener.Addr().String(), "", tt.header)
+		if conn != nil || resp.StatusCode != tt.code {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.code)
+		}
+	}
+	if _, resp := dial(t, srv.Listener.Addr().String(), "", http.Header{"Sec-Websocket-Version": {"8"}}); resp.Header.Get("Sec-WebSocket-Version") != "13" {
+		t.Error("426 response does not advertise version 13")
+	}
+}
+
+// wrappedWriter hides the Hijacker of the writer it wraps, as logging
+// middleware usually does, but exposes it through Unwrap.
+type wrappedWriter struct {
+	http.ResponseWriter
+}
+
+func (w *wrappedWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func TestWrappedWriter(t *testing.T) {
+	app := octopus.New()
+	app.Use(func(c *octopus.Ctx) error {
+		c.SetResponse(&wrappedWriter{c.Response()})
+		return c.Next()
+	})
+	app.Get("/ws", echo(nil))
+	srv := httptest.NewServer(app)
+	t.Cleanup(srv.Close)
+
+	conn, resp := dial(t, srv.Listener.Addr().String(), "", nil)
+	if conn == nil {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	if err := conn.WriteMessage(TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "hello" {
+		t.Errorf("got %q, %v", data, err)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	big := bytes.Repeat([]byte("octopus "), 10000)
+	for _, tt := range []struct {
+		name   string
+		conf   *Config
+		header http.Header
+	}{
+		{"plain", nil, nil},
+		{"fragmented", &Config{FragmentSize: 7}, nil},
+		{"deflate", &Config{EnableCompression: true, FragmentSize: 100},
+			http.Header{"Sec-Websocket-Extensions": {"permessage-deflate; client_max_window_bits"}}},
+	} {
+		srv := newServer(t, echo(tt.conf))
+		conn, _ := dial(t, srv.Listener.Addr().String(), "", tt.header)
+		if got := conn.Compressed(); got != (tt.header != nil) {
+			t.Errorf("%s: Compressed = %v", tt.name, got)
+		}
+		conn.config.FragmentSize = 3
+
+		messages := []struct {
+			t    MessageType
+			data []byte
+		}{
+			{TextMessage, []byte("héllo")},
+			{BinaryMessage, []byte{0, 1, 2, 255}},
+			{TextMessage, nil},
+			{BinaryMessage, big},
+		}
+		for _, m := range messages {
+			if err := conn.WriteMessage(m.t, m.data); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if typ != m.t || !bytes.Equal(data, m.data) {
+				t.Errorf("%s: got %d %.20q, want %d %.20q", tt.name, typ, data, m.t, m.data)
+			}
+		}
+	}
+}
+
+func TestPingPong(t *testing.T) {
+	srv := newServer(t, echo(nil))
+	conn, _ := dial(t, srv.Listener.Addr().String(), "", nil)
+
+	pongs := make(chan string, 1)
+	conn.SetPongHandler(func(data []byte) { pongs <- string(data) })
+	if err := conn.Ping([]byte("are you there")); err != nil {
+		t.Fatal(err)
+	}
+	conn.WriteText("after ping")
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "after ping" {
+		t.Fatalf("ReadMessage = %q, %v", data, err)
+	}
+	select {
+	case p := <-pongs:
+		if p != "are you there" {
+			t.Errorf("pong payload %q", p)
+		}
+	default:
+		t.Error("no pong received before the echoed message")
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	srv := newServer(t, echo(&Config{ReadLimit: 1000}))
+	mask := []byte{1, 2, 3, 4}
+
+	tests := []struct {
+		name  string
+		frame []byte
+		code  int
+	}{
+		{"unmasked", appendFrame(nil, true, false, opText, nil, []byte("x")), CloseProtocolError},
+		{"invalid utf-8", appendFrame(nil, true, false, opText, mask, []byte{0xff, 0xfe}), CloseInvalidFramePayloadData},
+		{"too big", appendFrame(nil, true, false, opBinary, mask, make([]byte, 1001)), CloseMessageTooBig},
+		{"reserved opcode", appendFrame(nil, true, false, 0x3, mask, nil), CloseProtocolError},
+		{"lone continuation", appendFrame(nil, true, false, opContinuation, mask, []byte("x")), CloseProtocolError},
+		{"fragmented ping", appendFrame(nil, false, false, opPing, mask, nil), CloseProtocolError},
+		{"rsv1 without deflate", appendFrame(nil, true, true, opText, mask, []byte("x")), CloseProtocolError},
+		{"bad close code", appendFrame(nil, true, false, opClose, mask, closePayload(1005+1, "")), CloseProtocolError},
+	}
+	for _, tt := range tests {
+		conn, _ := dial(t, srv.Listener.Addr().String(), "", nil)
+		conn.conn.Write(tt.frame)
+		_, _, err := conn.ReadMessage()
+		if !IsCloseError(err, tt.code) {
+			t.Errorf("%s: got %v, want close %d", tt.name, err, tt.code)
+		}
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	received := make(chan error, 1)
+	srv := newServer(t, func(c *octopus.Ctx) error {
+		conn, err := Upgrade(c, nil)
+		if err != nil {
+			return err
+		}
+		_, _, err = conn.ReadMessage()
+		received <- err
+		return nil
+	})
+	conn, _ := dial(t, srv.Listener.Addr().String(), "", nil)
+
+	if err := conn.CloseWithCode(4000, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-received; !IsCloseError(err, 4000) || err.(*CloseError).Reason != "bye" {
+		t.Errorf("server got %v", err)
+	}
+	// The server echoes the code and closes the TCP connection
+	if _, _, err := conn.ReadMessage(); !IsCloseError(err, 4000) {
+		t.Errorf("client got %v", err)
+	}
+	select {
+	case <-conn.Done():
+	case <-time.After(time.Second):
+		t.Error("connection not closed")
+	}
+	if err := conn.WriteText("late"); err != ErrCloseSent {
+		t.Errorf("WriteText after close = %v", err)
+	}
+}
+
+func TestHub(t *testing.T) {
+	hub := New()
+	srv := newServer(t, func(c *octopus.Ctx) error {
+		conn, err := hub.Upgrade(c, &Config{ID: c.Query("id")})
+		if err != nil {
+			return err
+		}
+		if room := c.Query("room"); room != "" {
+			hub.Join(conn.ID(), room)
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return nil
+			}
+		}
+	})
+	connect := func(query string) *Conn {
+		conn, _ := dial(t, srv.Listener.Addr().String(), "?"+query, nil)
+		return conn
+	}
+	alice := connect("id=alice&room=general")
+	bob := connect("id=bob&room=general")
+	carol := connect("id=carol")
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Len() != 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	read := func(conn *Conn, want string) {
+		t.Helper()
+		_, data, err := conn.ReadMessage()
+		if err != nil || string(data) != want {
+			t.Errorf("got %q, %v, want %q", data, err, want)
+		}
+	}
+
+	if n := hub.Publish("general", TextMessage, []byte("hi room"), "alice"); n != 1 {
+		t.Errorf("Publish reached %d connections, want 1", n)
+	}
+	read(bob, "hi room")
+	if n := hub.Broadcast(TextMessage, []byte("hi all")); n != 3 {
+		t.Errorf("Broadcast reached %d connections, want 3", n)
+	}
+	read(alice, "hi all")
+	read(bob, "hi all")
+	read(carol, "hi all")
+
+	hub.Leave("bob", "general")
+	if rooms := hub.Rooms("bob"); len(rooms) != 0 {
+		t.Errorf("bob is still in %v", rooms)
+	}
+	carol.Close()
+	carol.ReadMessage()
+	for hub.Len() != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, ok := hub.Get("carol"); ok {
+		t.Error("closed connection is still registered")
+	}
+}
+
+func TestShutdownClosesConnections(t *testing.T) {
+	app := octopus.New()
+	app.Get("/ws", echo(nil))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Serve(ln)
+
+	conn, _ := dial(t, ln.Addr().String(), "", nil)
+	if conn == nil {
+		t.Fatal("handshake failed")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go app.Shutdown(ctx)
+
+	if _, _, err := conn.ReadMessage(); !IsCloseError(err, CloseGoingAway) {
+		t.Errorf("got %v, want close 1001", err)
+	}
+}